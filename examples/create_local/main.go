@@ -3,10 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/engine"
 	"log"
 	"os"
 	"path/filepath"
-	"github.com/WowoEngine/SawitDB-Go/internal/engine"
 )
 
 func main() {
@@ -42,9 +42,9 @@ func main() {
 	query(db, "TANAM KE karet (id, jenis, lokasi) BIBIT (1, 'GT1', 'Blok A')")
 	query(db, "TANAM KE karet (id, jenis, lokasi) BIBIT (2, 'PB260', 'Blok A')")
 
-	query(db, "TANAM KE sawit (id, bibit, umur) BIBIT (101, 'Dura', 2)")
-	query(db, "TANAM KE sawit (id, bibit, umur) BIBIT (102, 'Tenera', 5)")
-	query(db, "TANAM KE sawit (id, bibit, umur) BIBIT (103, 'Pisifera', 1)")
+	query(db, "TANAM KE sawit (id, bibit, umur, lokasi) BIBIT (101, 'Dura', 2, 'Blok A')")
+	query(db, "TANAM KE sawit (id, bibit, umur, lokasi) BIBIT (102, 'Tenera', 5, 'Blok B')")
+	query(db, "TANAM KE sawit (id, bibit, umur, lokasi) BIBIT (103, 'Pisifera', 1, 'Blok C')")
 
 	query(db, "TANAM KE kopi (kode, varietas) BIBIT ('K01', 'Robusta')")
 	query(db, "TANAM KE kopi (kode, varietas) BIBIT ('K02', 'Arabika')")
@@ -53,6 +53,12 @@ func main() {
 	printQuery(db, "Karet:", "PANEN * DARI karet")
 	printQuery(db, "Sawit:", "PANEN * DARI sawit")
 	printQuery(db, "Kopi:", "PANEN * DARI kopi")
+
+	fmt.Println("\n--- JOIN TEST ---")
+	printQuery(db, "Karet GABUNG Sawit (PADA lokasi):",
+		"PANEN karet.jenis, sawit.bibit DARI karet GABUNG sawit PADA karet.lokasi = sawit.lokasi")
+	printQuery(db, "Karet KIRI GABUNG Sawit (PADA lokasi):",
+		"PANEN karet.jenis, sawit.bibit DARI karet KIRI GABUNG sawit PADA karet.lokasi = sawit.lokasi")
 }
 
 func query(db *engine.SawitDB, q string) {
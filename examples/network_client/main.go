@@ -3,8 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/pkg/client"
 	"log"
-	"sawitdb/pkg/client"
 )
 
 func main() {
@@ -33,8 +33,13 @@ func main() {
 	}
 	fmt.Println("")
 
-	// Insert data
-	fmt.Println("[3] Inserting data...")
+	// Insert data, all in one atomic transaction
+	fmt.Println("[3] Inserting data (in a transaction)...")
+	tx, err := c.Begin()
+	if err != nil {
+		log.Fatalf("Begin failed: %v", err)
+	}
+
 	queries := []string{
 		"TANAM KE sawit_block_a (id, jenis, umur, produksi) BIBIT (1, 'Tenera', 5, 120)",
 		"TANAM KE sawit_block_a (id, jenis, umur, produksi) BIBIT (2, 'Dura', 3, 80)",
@@ -44,13 +49,33 @@ func main() {
 	}
 
 	for _, q := range queries {
-		_, err := c.Query(q, nil)
-		if err != nil {
+		if _, err := tx.Query(q, nil); err != nil {
+			tx.Rollback()
 			log.Fatalf("Insert failed: %v", err)
 		}
 	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Commit failed: %v", err)
+	}
 	fmt.Println("✓ Inserted 5 records")
 
+	// Prepared statement: parsed once server-side, reused with different args
+	fmt.Println("[3b] Preparing a statement and running it with different args...")
+	stmt, err := c.Prepare("PANEN * DARI sawit_block_a DIMANA jenis = @jenis")
+	if err != nil {
+		log.Fatalf("Prepare failed: %v", err)
+	}
+	for _, jenis := range []string{"Tenera", "Dura"} {
+		res, err := stmt.Query(map[string]interface{}{"jenis": jenis})
+		if err != nil {
+			log.Printf("Error: %v", err)
+			continue
+		}
+		fmt.Printf("%s: %v\n", jenis, res)
+	}
+	fmt.Println("")
+
 	// Select all
 	fmt.Println("[4] Selecting all data...")
 	printQuery(c, "PANEN * DARI sawit_block_a")
@@ -0,0 +1,54 @@
+package auth
+
+// Role is a user's permission level on one database. Roles are ordered -
+// Write implies Read and Admin implies both - rather than an independent
+// bitmask, since every operation this server has falls cleanly on one
+// line: look, change, or manage.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleRead
+	RoleWrite
+	RoleAdmin
+)
+
+// ParseRole maps a config string ("read", "write", "admin") to a Role.
+// An unrecognized string is RoleNone, which Allows never satisfies -
+// a typo in a config file should fail closed, not grant access.
+func ParseRole(s string) Role {
+	switch s {
+	case "read":
+		return RoleRead
+	case "write":
+		return RoleWrite
+	case "admin":
+		return RoleAdmin
+	default:
+		return RoleNone
+	}
+}
+
+// Allows reports whether a user holding have is permitted to perform an
+// operation that needs need.
+func Allows(have, need Role) bool {
+	return have >= need
+}
+
+// User is one configured account: its password hash (see HashPassword) and
+// its per-database roles. Scopes["*"] is the role applied to a database
+// with no entry of its own, so a single-database deployment doesn't need
+// to repeat the database name.
+type User struct {
+	PasswordHash string
+	Scopes       map[string]Role
+}
+
+// RoleFor returns user's role on database, falling back to the wildcard
+// scope if database has no entry of its own.
+func (u User) RoleFor(database string) Role {
+	if role, ok := u.Scopes[database]; ok {
+		return role
+	}
+	return u.Scopes["*"]
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// hashIterations is the stdlib-only stand-in for bcrypt's cost factor -
+// plain repeated SHA-256 over the salted password, the same idea bcrypt's
+// key-stretching is built on, just without the memory-hardness a real KDF
+// would add.
+const hashIterations = 100000
+
+// HashPassword returns a string safe to store in Config - a random salt and
+// the iterated hash of password, encoded as "salt$hash" (both
+// base64.RawURLEncoding). Verify with VerifyPassword; there's no way back
+// to the original password from this string.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := iteratedHash(password, salt)
+	return fmt.Sprintf("%s$%s", base64.RawURLEncoding.EncodeToString(salt), base64.RawURLEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPassword reports whether password matches encoded, a string
+// previously returned by HashPassword. A malformed encoded string never
+// matches.
+func VerifyPassword(password, encoded string) bool {
+	parts := strings.SplitN(encoded, "$", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	got := iteratedHash(password, salt)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+func iteratedHash(password string, salt []byte) []byte {
+	h := append(append([]byte{}, salt...), password...)
+	sum := sha256.Sum256(h)
+	for i := 0; i < hashIterations; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum[:]
+}
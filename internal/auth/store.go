@@ -0,0 +1,162 @@
+// Package auth gives SawitServer persistent login sessions and per-user
+// database ACLs. Store persists its whole session table as one JSON file
+// instead of an embedded KV engine (boltdb/leveldb), and password hashing
+// below uses a stdlib-only salted, iterated SHA-256 instead of bcrypt - see
+// docs/adr/0001-no-third-party-dependencies.md for why. Neither is a
+// drop-in for the real thing at very large session counts or adversarial
+// password-cracking budgets, but both give the behavior this package
+// exists for: sessions survive a restart, and passwords are never stored
+// or compared in the clear.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session is one logged-in client: the opaque token a reconnecting client
+// presents instead of a username/password, who it belongs to, and when it
+// stops being valid.
+type Session struct {
+	Token     string    `json:"token"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (s Session) expired(now time.Time) bool {
+	return now.After(s.ExpiresAt)
+}
+
+// Store is a file-backed table of live Sessions, keyed by token. All of
+// Store's methods are safe for concurrent use.
+type Store struct {
+	path string
+
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewStore opens (or creates) the session file at path, loading whatever
+// sessions were persisted there - expired ones are dropped on load rather
+// than carried forward.
+func NewStore(path string) (*Store, error) {
+	st := &Store{path: path, sessions: make(map[string]Session)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return st, nil
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, sess := range sessions {
+		if !sess.expired(now) {
+			st.sessions[sess.Token] = sess
+		}
+	}
+	return st, nil
+}
+
+// Create mints a new session for username, valid for ttl, and persists it.
+func (st *Store) Create(username string, ttl time.Duration) (Session, error) {
+	token, err := newToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	sess := Session{
+		Token:     token,
+		Username:  username,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	st.mu.Lock()
+	st.sessions[sess.Token] = sess
+	err = st.saveLocked()
+	st.mu.Unlock()
+
+	return sess, err
+}
+
+// Lookup returns the session for token if it exists and hasn't expired. An
+// expired session is pruned on the spot rather than waiting for the next
+// janitor pass.
+func (st *Store) Lookup(token string) (Session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, ok := st.sessions[token]
+	if !ok {
+		return Session{}, false
+	}
+	if sess.expired(time.Now()) {
+		delete(st.sessions, token)
+		st.saveLocked()
+		return Session{}, false
+	}
+	return sess, true
+}
+
+// Prune removes every expired session and returns how many it removed.
+func (st *Store) Prune() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for token, sess := range st.sessions {
+		if sess.expired(now) {
+			delete(st.sessions, token)
+			removed++
+		}
+	}
+	if removed > 0 {
+		st.saveLocked()
+	}
+	return removed
+}
+
+// RunJanitor prunes expired sessions every interval until the process
+// exits - there's no stop channel, the same lifetime as SawitServer.Start's
+// own accept loop.
+func (st *Store) RunJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		st.Prune()
+	}
+}
+
+// saveLocked rewrites the whole session file. Callers must hold st.mu.
+func (st *Store) saveLocked() error {
+	sessions := make([]Session, 0, len(st.sessions))
+	for _, sess := range st.sessions {
+		sessions = append(sessions, sess)
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(st.path, data, 0600)
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,456 @@
+// Package cluster is a deliberately small leader/follower replication layer
+// for SawitServer, standing in for the hashicorp/raft this was originally
+// asked to wrap (see docs/adr/0001-no-third-party-dependencies.md). What
+// this package gives instead is the minimum that gets a multi-node
+// SawitDB deployment actually replicating writes: the cluster's leader is
+// whichever peer's BindAddr sorts first among Config.Peers - a static,
+// deterministic stand-in for an election - and it ships every write it
+// accepts, serialized, to every other peer over a plain TCP connection. A
+// follower sends a join message as soon as it dials in, receives a snapshot
+// of the leader's data directory in reply so it starts from the same state
+// rather than an empty one, and from then on just replays whatever entries
+// it's sent; a graceful disconnect sends a leave message so the leader drops
+// it immediately instead of waiting for a write to fail against it.
+//
+// What this does NOT do, compared to real Raft: no leader election (a dead
+// leader stalls writes until an operator reconfigures Peers, rather than
+// triggering a vote) and no quorum/commit-index bookkeeping (a follower
+// that's unreachable when a write goes out simply misses it until it
+// reconnects and falls behind - join only catches a follower up once, at
+// connect time). It's the replication plumbing a future real consensus
+// implementation could sit behind, not a drop-in replacement for one.
+package cluster
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes one node's place in the cluster.
+type Config struct {
+	NodeID   string
+	BindAddr string   // this node's own replication address, host:port
+	Peers    []string // every node's BindAddr, including this one
+	DataDir  string
+}
+
+// Entry is one replicated write, exactly as a client submitted it.
+type Entry struct {
+	Database string                 `json:"database"`
+	Query    string                 `json:"query"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// Apply hands a follower an Entry the leader has shipped it, so it can
+// replay the same write against its own copy of Database. SawitServer binds
+// this to its applyReplicated method, which replays BUKA/BAKAR WILAYAH
+// itself - those are server-level file management intercepted before a
+// query ever reaches the parser - and hands every other entry to
+// engine.SawitDB.Query.
+type Apply func(entry Entry) error
+
+// message is one line of the replication connection's newline-delimited
+// JSON stream. Type selects which of the other fields are populated:
+//
+//	"join"     follower -> leader, once, immediately after dialing in
+//	"welcome"  leader -> follower, answers join with a snapshot of every
+//	           *.sawit file under DataDir plus the leader's current peer
+//	           list, so the follower starts caught up instead of empty
+//	"entry"    leader -> follower, a replicated write (repeated)
+//	"leave"    follower -> leader, sent right before a graceful
+//	           disconnect so the leader drops it immediately rather than
+//	           waiting for a write to fail against it
+type message struct {
+	Type     string   `json:"type"`
+	NodeID   string   `json:"node_id,omitempty"`
+	BindAddr string   `json:"bind_addr,omitempty"`
+	Peers    []string `json:"peers,omitempty"`
+	Snapshot []byte   `json:"snapshot,omitempty"` // tar.gz of DataDir; json.Marshal base64-encodes a []byte
+	Entry    *Entry   `json:"entry,omitempty"`
+}
+
+// Node is one member of a statically configured cluster.
+type Node struct {
+	cfg   Config
+	apply Apply
+
+	leader   string
+	isLeader bool
+
+	mu        sync.Mutex
+	followers map[string]net.Conn // leader only: live connections, by peer addr
+	peers     []string            // grows as followers join; starts as cfg.Peers
+}
+
+// New builds a Node for cfg, determining leadership by sorting Peers -
+// cfg.Peers must list every member's BindAddr, including this node's own.
+func New(cfg Config, apply Apply) *Node {
+	peers := append([]string(nil), cfg.Peers...)
+	sort.Strings(peers)
+
+	leader := cfg.BindAddr
+	if len(peers) > 0 {
+		leader = peers[0]
+	}
+
+	return &Node{
+		cfg:       cfg,
+		apply:     apply,
+		leader:    leader,
+		isLeader:  leader == cfg.BindAddr,
+		followers: make(map[string]net.Conn),
+		peers:     peers,
+	}
+}
+
+// IsLeader reports whether this node currently accepts writes.
+func (n *Node) IsLeader() bool {
+	return n.isLeader
+}
+
+// LeaderAddr returns the current leader's BindAddr, for a redirect reply to
+// a client that submitted a write to a follower.
+func (n *Node) LeaderAddr() string {
+	return n.leader
+}
+
+// Peers returns every BindAddr this node currently knows about - cfg.Peers
+// at startup, plus any follower that has since joined. Leader-side only;
+// a follower's own view never grows past what its last welcome reported.
+func (n *Node) Peers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.peers...)
+}
+
+// Start begins serving (the leader listens for followers to connect) or
+// joining (a follower dials the leader and replays whatever it sends)
+// replication traffic. It returns once the leader's listener is up, or
+// immediately for a follower - the follower's connection attempt retries in
+// the background, so a follower started before its leader doesn't need to
+// be restarted once the leader comes up.
+func (n *Node) Start() error {
+	if n.isLeader {
+		ln, err := net.Listen("tcp", n.cfg.BindAddr)
+		if err != nil {
+			return err
+		}
+		go n.acceptFollowers(ln)
+		return nil
+	}
+
+	go n.followLeader()
+	return nil
+}
+
+func (n *Node) acceptFollowers(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go n.handleFollower(conn)
+	}
+}
+
+// handleFollower answers one follower connection's join with a snapshot and
+// the current peer list, registers it to receive future Replicate calls,
+// then keeps reading the connection only to notice a graceful "leave" or a
+// disconnect - the follower itself never sends anything else.
+func (n *Node) handleFollower(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return
+	}
+	var join message
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &join); err != nil {
+		conn.Close()
+		return
+	}
+	if join.Type == "leave" {
+		n.mu.Lock()
+		if c, ok := n.followers[join.BindAddr]; ok {
+			delete(n.followers, join.BindAddr)
+			c.Close()
+		}
+		n.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if join.Type != "join" {
+		conn.Close()
+		return
+	}
+
+	snapshot, err := n.snapshotDataDir()
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	n.mu.Lock()
+	if join.BindAddr != "" && !contains(n.peers, join.BindAddr) {
+		n.peers = append(n.peers, join.BindAddr)
+	}
+	peers := append([]string(nil), n.peers...)
+	n.mu.Unlock()
+
+	welcome := message{Type: "welcome", Peers: peers, Snapshot: snapshot}
+	if err := n.sendMessage(conn, welcome); err != nil {
+		conn.Close()
+		return
+	}
+
+	addr := join.BindAddr
+	if addr == "" {
+		addr = conn.RemoteAddr().String()
+	}
+	n.mu.Lock()
+	n.followers[addr] = conn
+	n.mu.Unlock()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			n.dropFollower(addr, conn)
+			return
+		}
+		var msg message
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &msg); err == nil && msg.Type == "leave" {
+			n.dropFollower(addr, conn)
+			return
+		}
+	}
+}
+
+func (n *Node) dropFollower(addr string, conn net.Conn) {
+	n.mu.Lock()
+	if n.followers[addr] == conn {
+		delete(n.followers, addr)
+	}
+	n.mu.Unlock()
+	conn.Close()
+}
+
+// followLeader dials the leader, announces itself with a join message,
+// installs the snapshot the leader's welcome answers with, and then replays
+// every entry the leader streams afterward - one newline-delimited JSON
+// message per line, the same framing convention the client-facing protocol
+// uses before a connection negotiates binary framing. A dropped connection
+// is retried rather than treated as fatal, since a follower outliving a
+// leader's restart is the common case, not an exceptional one; each
+// reconnect rejoins and re-installs a fresh snapshot, so a follower that
+// fell behind while disconnected catches back up instead of replaying a gap
+// it never received.
+func (n *Node) followLeader() {
+	for {
+		conn, err := net.Dial("tcp", n.leader)
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		n.joinAndReplay(conn)
+		conn.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+func (n *Node) joinAndReplay(conn net.Conn) {
+	join := message{Type: "join", NodeID: n.cfg.NodeID, BindAddr: n.cfg.BindAddr}
+	if err := n.sendMessage(conn, join); err != nil {
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	var welcome message
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &welcome); err != nil || welcome.Type != "welcome" {
+		return
+	}
+	if err := n.installSnapshot(welcome.Snapshot); err != nil {
+		return
+	}
+	if len(welcome.Peers) > 0 {
+		n.mu.Lock()
+		n.peers = welcome.Peers
+		n.mu.Unlock()
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.Type != "entry" || msg.Entry == nil {
+			continue
+		}
+		n.apply(*msg.Entry)
+	}
+}
+
+// Leave tells the leader this node is stepping down gracefully, so the
+// leader drops it from its followers immediately rather than discovering
+// it's gone from a failed write. Peers is left as it is. A no-op for the leader itself, which has
+// no one to notify.
+func (n *Node) Leave() {
+	if n.isLeader {
+		return
+	}
+	conn, err := net.Dial("tcp", n.leader)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	n.sendMessage(conn, message{Type: "leave", NodeID: n.cfg.NodeID, BindAddr: n.cfg.BindAddr})
+}
+
+func (n *Node) sendMessage(conn net.Conn, msg message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	payload = append(payload, '\n')
+	_, err = conn.Write(payload)
+	return err
+}
+
+// snapshotDataDir tars and gzips every *.sawit file directly under DataDir,
+// so a newly joined follower can be seeded with the leader's current state
+// instead of starting empty. It's a point-in-time read with no coordination
+// against concurrent writes - good enough for the startup-time catch-up
+// this exists for (NewSawitServer in server.go starts a node's cluster
+// before Start accepts any client, so before the node opens a database file
+// on a client's behalf), not a live hot-swap
+// of a database already open elsewhere in the process.
+func (n *Node) snapshotDataDir() ([]byte, error) {
+	entries, err := os.ReadDir(n.cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sawit") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(n.cfg.DataDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: e.Name(), Mode: 0600, Size: int64(len(data))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// installSnapshot extracts a snapshotDataDir blob into DataDir, overwriting
+// any same-named file already there. An empty blob (no *.sawit files on the
+// leader yet) is a valid, do-nothing snapshot.
+func (n *Node) installSnapshot(blob []byte) error {
+	if len(blob) == 0 {
+		return nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	if err := os.MkdirAll(n.cfg.DataDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(n.cfg.DataDir, hdr.Name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, copyErr := io.Copy(f, tr)
+		closeErr := f.Close()
+		if copyErr != nil {
+			return copyErr
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Replicate ships entry to every connected follower. It is fire-and-forget:
+// a follower that's unreachable right now just misses this entry and falls
+// behind until it reconnects, at which point rejoining re-snapshots it back
+// to current rather than replaying the missed entries individually (see the
+// package doc's limitations) - the leader's own write, already applied
+// locally by the caller before Replicate runs, is never rolled back on a
+// follower's account.
+func (n *Node) Replicate(entry Entry) {
+	if !n.isLeader {
+		return
+	}
+	payload, err := json.Marshal(message{Type: "entry", Entry: &entry})
+	if err != nil {
+		return
+	}
+	payload = append(payload, '\n')
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for addr, conn := range n.followers {
+		if _, err := conn.Write(payload); err != nil {
+			conn.Close()
+			delete(n.followers, addr)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func mustQuery(t *testing.T, db *SawitDB, query string) interface{} {
+	t.Helper()
+	res, err := db.Query(query, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+func TestAggregateGroupConcatWithHaving(t *testing.T) {
+	db, err := NewSawitDB(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("NewSawitDB: %v", err)
+	}
+	defer db.Close()
+
+	mustQuery(t, db, "LAHAN sawit_block_a")
+	mustQuery(t, db, "TANAM KE sawit_block_a (jenis, umur) BIBIT ('Tenera', 5)")
+	mustQuery(t, db, "TANAM KE sawit_block_a (jenis, umur) BIBIT ('Dura', 5)")
+	mustQuery(t, db, "TANAM KE sawit_block_a (jenis, umur) BIBIT ('Pisifera', 3)")
+
+	res := mustQuery(t, db, "HITUNG GROUP_CONCAT(jenis) DARI sawit_block_a KELOMPOK umur PUNYA COUNT(*) > 1")
+	rows, ok := res.([]map[string]interface{})
+	if !ok {
+		t.Fatalf("expected rows, got %T", res)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 group with count > 1, got %d: %+v", len(rows), rows)
+	}
+	if rows[0]["umur"] != float64(5) && rows[0]["umur"] != int64(5) && rows[0]["umur"] != 5 {
+		t.Errorf("expected the umur=5 group, got %+v", rows[0])
+	}
+	concat, _ := rows[0]["group_concat"].(string)
+	if concat != "Tenera,Dura" {
+		t.Errorf("expected group_concat %q, got %q", "Tenera,Dura", concat)
+	}
+}
+
+// TestAggregateHavingOnDifferentFieldThanSelect guards against the bug where
+// PUNYA/HAVING's own aggregate field was discarded and the engine always
+// evaluated the HAVING predicate against the top-level HITUNG field instead.
+func TestAggregateHavingOnDifferentFieldThanSelect(t *testing.T) {
+	db, err := NewSawitDB(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("NewSawitDB: %v", err)
+	}
+	defer db.Close()
+
+	mustQuery(t, db, "LAHAN orders")
+	mustQuery(t, db, "TANAM KE orders (customer, amount) BIBIT ('x', 10)")
+	mustQuery(t, db, "TANAM KE orders (customer, amount) BIBIT ('x', 20)")
+	mustQuery(t, db, "TANAM KE orders (customer, amount) BIBIT ('y', 600)")
+	mustQuery(t, db, "TANAM KE orders (customer, amount) BIBIT ('y', 400)")
+
+	res := mustQuery(t, db, "HITUNG COUNT(*) DARI orders KELOMPOK customer PUNYA SUM(amount) > 100")
+	rows, ok := res.([]map[string]interface{})
+	if !ok {
+		t.Fatalf("expected rows, got %T", res)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected exactly customer y (sum=1000), got %d rows: %+v", len(rows), rows)
+	}
+	if rows[0]["customer"] != "y" {
+		t.Errorf("expected customer y, got %+v", rows[0])
+	}
+}
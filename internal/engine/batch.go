@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"github.com/WowoEngine/SawitDB-Go/internal/storage"
+	"strings"
+)
+
+// pageOverlay stages page writes in memory ahead of making them durable, so
+// a WriteBatch's queued operations can be computed one after another - each
+// seeing every earlier op's effect on the same table - before any of it
+// touches the Pager. Reads fall through to the Pager on a miss; writes only
+// ever land in the overlay until the batch commits them all at once.
+type pageOverlay struct {
+	pager *storage.Pager
+	pages map[uint32][]byte
+}
+
+func newPageOverlay(pager *storage.Pager) *pageOverlay {
+	return &pageOverlay{pager: pager, pages: make(map[uint32][]byte)}
+}
+
+func (o *pageOverlay) read(pageId uint32) ([]byte, error) {
+	if buf, ok := o.pages[pageId]; ok {
+		return buf, nil
+	}
+	buf, err := o.pager.ReadPage(pageId)
+	if err != nil {
+		return nil, err
+	}
+	cp := make([]byte, len(buf))
+	copy(cp, buf)
+	return cp, nil
+}
+
+func (o *pageOverlay) write(pageId uint32, buf []byte) {
+	o.pages[pageId] = buf
+}
+
+// WriteBatch accumulates INSERT/UPDATE/DELETE operations and applies all of
+// them as a single atomic unit: one WAL entry covering every page the whole
+// batch touches, written and fsynced in one pass. This is the atomicity Tx
+// (tx.go) doesn't give its buffered ops - Tx.Commit applies each op with its
+// own WriteMutationTx call, so a crash between two of them leaves the first
+// durable and the rest not. updateTx's internal delete-then-insert has the
+// same gap; update itself goes through a WriteBatch. WriteBatch.Commit
+// closes the gap by staging every op's effect against pageOverlay before a
+// single WriteMutation call makes any of it durable, so either the whole
+// batch lands or none of it does.
+type WriteBatch struct {
+	db  *SawitDB
+	ops []txOp
+}
+
+// Batch opens a new write batch.
+func (db *SawitDB) Batch() *WriteBatch {
+	return &WriteBatch{db: db}
+}
+
+func (b *WriteBatch) Insert(table string, rows []map[string]interface{}) {
+	b.ops = append(b.ops, txOp{kind: "INSERT", table: table, rows: rows})
+}
+
+func (b *WriteBatch) Update(table string, updates map[string]interface{}, criteria *parser.Criteria) {
+	b.ops = append(b.ops, txOp{kind: "UPDATE", table: table, updates: updates, criteria: criteria})
+}
+
+func (b *WriteBatch) Delete(table string, criteria *parser.Criteria) {
+	b.ops = append(b.ops, txOp{kind: "DELETE", table: table, criteria: criteria})
+}
+
+// batchEffect records one row's net effect on a table so indexes and CDC
+// subscribers can be notified after the batch is durable. before/after are
+// nil for a pure insert/delete; both set means an update.
+type batchEffect struct {
+	op     string
+	table  string
+	before map[string]interface{}
+	after  map[string]interface{}
+}
+
+// Commit stages every queued operation against one pageOverlay, in order,
+// then durably applies the result as a single WriteMutation call. Index
+// maintenance and CDC notification - neither of which the WAL covers for
+// ordinary single-statement writes either - run only after that call
+// succeeds, mirroring how insertRowsNotify/deleteNotify/updateTx already
+// apply them after their own WriteMutationTx calls.
+func (b *WriteBatch) Commit() error {
+	overlay := newPageOverlay(b.db.Pager)
+	var effects []batchEffect
+
+	for _, op := range b.ops {
+		switch op.kind {
+		case "INSERT":
+			if err := b.db.stageInsert(overlay, op.table, op.rows); err != nil {
+				return err
+			}
+			for _, row := range op.rows {
+				effects = append(effects, batchEffect{op: "INSERT", table: op.table, after: row})
+			}
+		case "DELETE":
+			deleted, err := b.db.stageDelete(overlay, op.table, op.criteria)
+			if err != nil {
+				return err
+			}
+			for _, row := range deleted {
+				effects = append(effects, batchEffect{op: "DELETE", table: op.table, before: row})
+			}
+		case "UPDATE":
+			before, err := b.db.stageDelete(overlay, op.table, op.criteria)
+			if err != nil {
+				return err
+			}
+			var after []map[string]interface{}
+			for _, row := range before {
+				prior := cloneRow(row)
+				for k, v := range op.updates {
+					row[k] = v
+				}
+				after = append(after, row)
+				effects = append(effects, batchEffect{op: "UPDATE", table: op.table, before: prior, after: row})
+			}
+			if len(after) > 0 {
+				if err := b.db.stageInsert(overlay, op.table, after); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(overlay.pages) > 0 {
+		if err := b.db.Pager.WriteMutation("BATCH", "", overlay.pages); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range effects {
+		switch e.op {
+		case "INSERT":
+			b.db.updateIndexes(e.table, e.after)
+			b.db.cdc.publish("INSERT", e.table, nil, e.after)
+		case "DELETE":
+			b.db.removeFromIndexes(e.table, e.before)
+			b.db.cdc.publish("DELETE", e.table, e.before, nil)
+		case "UPDATE":
+			b.db.removeFromIndexes(e.table, e.before)
+			b.db.updateIndexes(e.table, e.after)
+			b.db.cdc.publish("UPDATE", e.table, e.before, e.after)
+		}
+	}
+
+	return nil
+}
+
+// findTableEntryOverlay is findTableEntry, but reading page 0 through
+// overlay so it sees any earlier op in the same batch that hasn't reached
+// the Pager yet.
+func (db *SawitDB) findTableEntryOverlay(overlay *pageOverlay, name string) (*TableEntry, error) {
+	p0, err := overlay.read(0)
+	if err != nil {
+		return nil, err
+	}
+
+	numTables := binary.LittleEndian.Uint32(p0[8:])
+	offset := 12
+	for i := 0; i < int(numTables); i++ {
+		tName := strings.TrimRight(string(p0[offset:offset+32]), "\x00")
+		if tName == name {
+			return &TableEntry{
+				Index:     i,
+				Offset:    int64(offset),
+				StartPage: binary.LittleEndian.Uint32(p0[offset+32:]),
+				LastPage:  binary.LittleEndian.Uint32(p0[offset+36:]),
+			}, nil
+		}
+		offset += 40
+	}
+	return nil, nil
+}
+
+// stageInsert is insertRowsNotify's page-layout logic, writing into overlay
+// instead of going straight to the Pager, so a WriteBatch can fold many ops
+// into one durable pass.
+func (db *SawitDB) stageInsert(overlay *pageOverlay, table string, rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return errors.New("Data kosong")
+	}
+
+	entry, err := db.findTableEntryOverlay(overlay, table)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("Kebun '%s' tidak ditemukan.", table)
+	}
+
+	page0, err := overlay.read(0)
+	if err != nil {
+		return err
+	}
+	totalPages := binary.LittleEndian.Uint32(page0[4:])
+
+	currentPageId := entry.LastPage
+	pData, err := overlay.read(currentPageId)
+	if err != nil {
+		return err
+	}
+
+	for idx, data := range rows {
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("Tuple %d: %v", idx, err)
+		}
+		uncompressedLen := len(dataBytes)
+
+		storedBytes, err := storage.Compress(db.compression, dataBytes)
+		if err != nil {
+			return fmt.Errorf("Tuple %d: %v", idx, err)
+		}
+
+		recordLen := len(storedBytes)
+		totalLen := recHeaderLen + recordLen
+		if 8+totalLen > storage.UsablePageSize {
+			return fmt.Errorf("Tuple %d: record melebihi ukuran satu halaman", idx)
+		}
+
+		freeOffset := binary.LittleEndian.Uint16(pData[6:])
+		if int(freeOffset)+totalLen > storage.UsablePageSize {
+			// Allocate purely from the overlay's in-memory totalPages counter,
+			// like insertRowsNotify does - not db.Pager.AllocPage, which would
+			// fsync the bumped page-0 count and the new page immediately,
+			// outside the single WriteMutation call Commit issues for the
+			// whole batch. A failed op later in the same batch must leave
+			// zero on-disk trace of this allocation.
+			newPageId := totalPages
+			totalPages++
+
+			binary.LittleEndian.PutUint32(pData[0:], newPageId)
+			overlay.write(currentPageId, pData)
+
+			newPage := make([]byte, storage.PAGE_SIZE)
+			binary.LittleEndian.PutUint16(newPage[6:], 8)
+
+			currentPageId = newPageId
+			pData = newPage
+			freeOffset = 8
+		}
+
+		writeRecordHeader(pData[freeOffset:], uint16(recordLen), db.nextSeq(), 0, db.compression, uint16(uncompressedLen))
+		copy(pData[freeOffset+recHeaderLen:], storedBytes)
+
+		count := binary.LittleEndian.Uint16(pData[4:])
+		binary.LittleEndian.PutUint16(pData[4:], count+1)
+		binary.LittleEndian.PutUint16(pData[6:], freeOffset+uint16(totalLen))
+
+		overlay.write(currentPageId, pData)
+	}
+
+	page0, err = overlay.read(0)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(page0[4:], totalPages)
+	if currentPageId != entry.LastPage {
+		binary.LittleEndian.PutUint32(page0[entry.Offset+36:], currentPageId)
+	}
+	overlay.write(0, page0)
+
+	return nil
+}
+
+// stageDelete is deleteNotify's tombstoning logic against overlay, returning
+// every row it tombstoned so the caller can maintain indexes and publish CDC
+// events once the batch actually commits.
+func (db *SawitDB) stageDelete(overlay *pageOverlay, table string, criteria *parser.Criteria) ([]map[string]interface{}, error) {
+	entry, err := db.findTableEntryOverlay(overlay, table)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("Kebun '%s' tidak ditemukan.", table)
+	}
+
+	var deleted []map[string]interface{}
+	currentPageId := entry.StartPage
+
+	for currentPageId != 0 {
+		pData, err := overlay.read(currentPageId)
+		if err != nil {
+			return nil, err
+		}
+
+		count := binary.LittleEndian.Uint16(pData[4:])
+		offset := 8
+		touched := false
+
+		for i := 0; i < int(count); i++ {
+			recLen, seq, delSeq, compType, uncompressedLen := readRecordHeader(pData[offset:])
+			stored := pData[offset+recHeaderLen : offset+recHeaderLen+int(recLen)]
+
+			if delSeq == 0 {
+				jsonBytes, err := storage.Decompress(compType, stored, int(uncompressedLen))
+				if err == nil {
+					var obj map[string]interface{}
+					if err := json.Unmarshal(jsonBytes, &obj); err == nil {
+						if db.checkMatch(obj, criteria) {
+							writeRecordHeader(pData[offset:], recLen, seq, db.nextSeq(), compType, uncompressedLen)
+							touched = true
+							deleted = append(deleted, obj)
+						}
+					}
+				}
+			}
+			offset += recHeaderLen + int(recLen)
+		}
+
+		if touched {
+			overlay.write(currentPageId, pData)
+		}
+		currentPageId = binary.LittleEndian.Uint32(pData[0:])
+	}
+
+	return deleted, nil
+}
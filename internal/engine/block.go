@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isBlockQuery reports whether queryString looks like a BEGIN ... COMMIT /
+// ROLLBACK block (several statements in one string) rather than a single
+// statement, so Query can route it to execBlock instead of the plan cache -
+// template caching and parameter binding both assume one Command per query.
+func isBlockQuery(queryString string) bool {
+	return strings.Contains(queryString, ";")
+}
+
+// execBlock desugars a "BEGIN stmt; stmt; ... COMMIT" or "... ROLLBACK"
+// block into a single WriteBatch: every TANAM/PUPUK/GUSUR statement between
+// BEGIN and the terminator is queued, then applied atomically under one
+// journal record on COMMIT, or discarded untouched on ROLLBACK.
+//
+// This is deliberately separate from db.Begin()/Tx (tx.go): that API is for
+// connection-scoped transactions built up interactively over many calls, and
+// needs table locking because its ops arrive one at a time with other work
+// possibly interleaved. A block is one query string known in full up front,
+// so it can skip locking and go straight through WriteBatch.
+func (db *SawitDB) execBlock(queryString string, params map[string]interface{}) (interface{}, error) {
+	var stmts []string
+	for _, s := range strings.Split(queryString, ";") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	if len(stmts) < 2 {
+		return nil, fmt.Errorf("Blok BEGIN memerlukan setidaknya satu pernyataan diikuti COMMIT/ROLLBACK")
+	}
+
+	begin := db.Parser.Parse(stmts[0], params)
+	if begin.Type != "TX_BEGIN" {
+		return nil, fmt.Errorf("Blok harus diawali MULAI TRANSAKSI/BEGIN")
+	}
+
+	last := db.Parser.Parse(stmts[len(stmts)-1], params)
+	if last.Type != "TX_COMMIT" && last.Type != "TX_ROLLBACK" {
+		return nil, fmt.Errorf("Blok harus diakhiri SIMPAN/COMMIT atau BATAL/ROLLBACK")
+	}
+
+	batch := db.Batch()
+	body := stmts[1 : len(stmts)-1]
+	for _, stmt := range body {
+		cmd := db.Parser.Parse(stmt, params)
+		switch cmd.Type {
+		case "ERROR":
+			return nil, fmt.Errorf("%s", cmd.Message)
+		case "INSERT":
+			batch.Insert(cmd.Table, cmd.Rows)
+		case "UPDATE":
+			batch.Update(cmd.Table, cmd.Updates, cmd.Criteria)
+		case "DELETE":
+			batch.Delete(cmd.Table, cmd.Criteria)
+		default:
+			return nil, fmt.Errorf("Blok BEGIN hanya mendukung TANAM/PUPUK/GUSUR, bukan %s", cmd.Type)
+		}
+	}
+
+	if last.Type == "TX_ROLLBACK" {
+		return "Blok dibatalkan.", nil
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Blok dengan %d pernyataan diterapkan.", len(body)), nil
+}
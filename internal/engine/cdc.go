@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ChangeEvent is one row mutation pushed to a table's subscribers. Before is
+// populated for UPDATE/DELETE, After for INSERT/UPDATE - whichever side
+// doesn't apply to the op is left nil.
+type ChangeEvent struct {
+	Op     string                 `json:"op"`
+	Table  string                 `json:"table"`
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+	LSN    int64                  `json:"lsn"`
+}
+
+// subscriberBufferSize bounds how far a subscriber can lag behind before the
+// hub drops it rather than blocking the writer whose mutation produced the
+// event it couldn't keep up with.
+const subscriberBufferSize = 256
+
+type cdcSubscriber struct {
+	table string
+	ch    chan ChangeEvent
+}
+
+// cdcHub assigns each committed mutation the next log-sequence number,
+// appends it to an on-disk tail so a reconnecting subscriber can replay what
+// it missed, and fans it out to every live subscriber of the table it
+// touched. lsn, the log file and the subscriber set are all guarded by the
+// same mutex: subscribing takes a consistent snapshot of "everything already
+// logged" at the moment it reads the tail, and any mutation published after
+// that moment is guaranteed to still find the new subscriber registered, so
+// the replayed backlog and the live feed never overlap or gap.
+type cdcHub struct {
+	mu          sync.Mutex
+	lsn         int64
+	log         *os.File
+	subscribers map[string]map[*cdcSubscriber]struct{}
+}
+
+func newCDCHub(dbFilePath string) (*cdcHub, error) {
+	f, err := os.OpenFile(dbFilePath+".cdclog", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &cdcHub{log: f, subscribers: make(map[string]map[*cdcSubscriber]struct{})}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev ChangeEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err == nil {
+			h.lsn = ev.LSN
+		}
+	}
+	return h, scanner.Err()
+}
+
+func (h *cdcHub) close() error {
+	return h.log.Close()
+}
+
+// publish assigns the next LSN to a mutation, appends it to the log, and
+// delivers it to every current subscriber of table.
+func (h *cdcHub) publish(op, table string, before, after map[string]interface{}) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lsn++
+	ev := ChangeEvent{Op: op, Table: table, Before: before, After: after, LSN: h.lsn}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := h.log.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+
+	for sub := range h.subscribers[table] {
+		select {
+		case sub.ch <- ev:
+		default:
+			// Slow consumer: drop it instead of making every writer wait on
+			// its pace.
+			delete(h.subscribers[table], sub)
+			close(sub.ch)
+		}
+	}
+	return ev.LSN, nil
+}
+
+// subscribe registers a new subscriber for table and, if fromLSN is non-nil,
+// returns the on-disk backlog newer than *fromLSN alongside it.
+func (h *cdcHub) subscribe(table string, fromLSN *int64) (*cdcSubscriber, []ChangeEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &cdcSubscriber{table: table, ch: make(chan ChangeEvent, subscriberBufferSize)}
+	if h.subscribers[table] == nil {
+		h.subscribers[table] = make(map[*cdcSubscriber]struct{})
+	}
+	h.subscribers[table][sub] = struct{}{}
+
+	if fromLSN == nil {
+		return sub, nil, nil
+	}
+
+	backlog, err := h.readLogTail(table, *fromLSN)
+	if err != nil {
+		delete(h.subscribers[table], sub)
+		return nil, nil, err
+	}
+	return sub, backlog, nil
+}
+
+func (h *cdcHub) unsubscribe(sub *cdcSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs, ok := h.subscribers[sub.table]; ok {
+		if _, ok := subs[sub]; ok {
+			delete(subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// readLogTail replays every logged event for table with LSN > afterLSN, in
+// order. Caller must hold h.mu.
+func (h *cdcHub) readLogTail(table string, afterLSN int64) ([]ChangeEvent, error) {
+	if _, err := h.log.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	defer h.log.Seek(0, 2)
+
+	var events []ChangeEvent
+	scanner := bufio.NewScanner(h.log)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev ChangeEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		if ev.Table == table && ev.LSN > afterLSN {
+			events = append(events, ev)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// Subscribe streams every INSERT/UPDATE/DELETE committed against table from
+// now on. If fromLSN is non-nil, the on-disk log tail newer than *fromLSN is
+// replayed first, so a reconnecting client resumes exactly where it left off
+// instead of missing events raised while it was disconnected. The returned
+// cancel func releases the subscriber slot and must be called once the
+// caller stops reading the channel.
+func (db *SawitDB) Subscribe(table string, fromLSN *int64) (<-chan ChangeEvent, func(), error) {
+	entry, err := db.findTableEntry(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, fmt.Errorf("Kebun '%s' tidak ditemukan.", table)
+	}
+
+	sub, backlog, err := db.cdc.subscribe(table, fromLSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	cancel := func() { db.cdc.unsubscribe(sub) }
+
+	if len(backlog) == 0 {
+		return sub.ch, cancel, nil
+	}
+
+	// Splice the replayed backlog in front of the live feed so the caller
+	// sees one ordered stream without knowing a replay happened.
+	out := make(chan ChangeEvent, subscriberBufferSize)
+	go func() {
+		defer close(out)
+		for _, ev := range backlog {
+			out <- ev
+		}
+		for ev := range sub.ch {
+			out <- ev
+		}
+	}()
+	return out, cancel, nil
+}
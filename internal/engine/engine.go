@@ -1,51 +1,126 @@
 package engine
 
 import (
+	"container/list"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/index"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"github.com/WowoEngine/SawitDB-Go/internal/storage"
 	"math"
 	"regexp"
-	"sawitdb/internal/index"
-	"sawitdb/internal/parser"
-	"sawitdb/internal/storage"
 	"sort"
 	"strings"
+	"sync"
 )
 
 type SawitDB struct {
-	Pager   *storage.Pager
+	Pager *storage.Pager
+	// indexMu guards every read and write of Indexes: it's read on every
+	// insert/update/delete/select that can use an index and written by
+	// createIndex/recoverIndexes/repair, plus - the reason this needs to be
+	// a real lock rather than just documentation - reindex's background
+	// rebuild goroutines, which swap a freshly built B-Tree in long after
+	// the query that triggered them has returned, concurrently with every
+	// other connection's own reads and writes of the same map.
+	indexMu sync.RWMutex
 	Indexes map[string]*index.BTreeIndex
 	Parser  *parser.QueryParser
+
+	txMu    sync.Mutex
+	txs     map[string]*Tx
+	txSeq   int
+	lockMgr *lockManager
+
+	plans       *planCache
+	cdc         *cdcHub
+	compression storage.CompressionType
+
+	seqMu     sync.Mutex
+	seq       uint64
+	snapshots *list.List // open *Snapshot values, oldest at Front
+}
+
+// Options configures a SawitDB opened with NewSawitDBWithOptions.
+type Options struct {
+	// Compression is the codec new records are stored with. Records written
+	// under a different codec in an earlier session remain readable - each
+	// one carries its own CompressionType in its header - so changing this
+	// between opens is safe and takes effect only for new writes.
+	Compression storage.CompressionType
 }
 
 func NewSawitDB(filePath string) (*SawitDB, error) {
+	return NewSawitDBWithOptions(filePath, Options{})
+}
+
+// NewSawitDBWithOptions opens filePath like NewSawitDB, with extra behavior
+// controlled by opts.
+func NewSawitDBWithOptions(filePath string, opts Options) (*SawitDB, error) {
 	pager, err := storage.NewPager(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return &SawitDB{
-		Pager:   pager,
-		Indexes: make(map[string]*index.BTreeIndex),
-		Parser:  parser.NewQueryParser(),
-	}, nil
+	cdc, err := newCDCHub(filePath)
+	if err != nil {
+		return nil, err
+	}
+	db := &SawitDB{
+		Pager:       pager,
+		Indexes:     make(map[string]*index.BTreeIndex),
+		Parser:      parser.NewQueryParser(),
+		txs:         make(map[string]*Tx),
+		lockMgr:     newLockManager(),
+		plans:       newPlanCache(128),
+		cdc:         cdc,
+		compression: opts.Compression,
+		snapshots:   list.New(),
+	}
+	if err := db.recoverSeq(); err != nil {
+		return nil, err
+	}
+	if err := db.recoverIndexes(); err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
 func (db *SawitDB) Close() error {
+	db.cdc.close()
 	return db.Pager.Close()
 }
 
+// Query parses queryString (consulting the plan cache so repeated SQL text
+// skips re-tokenizing) and runs it once. For the same statement run many
+// times with different values, Prepare avoids even the cache lookup overhead.
 func (db *SawitDB) Query(queryString string, params map[string]interface{}) (interface{}, error) {
-	cmd := db.Parser.Parse(queryString, params)
+	if isBlockQuery(queryString) {
+		return db.execBlock(queryString, params)
+	}
 
-	if cmd.Type == "EMPTY" {
+	template, err := db.plans.getOrParse(db.Parser, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if template.Type == "EMPTY" {
 		return "", nil
 	}
-	if cmd.Type == "ERROR" {
-		return nil, errors.New(cmd.Message)
+
+	cmd := cloneCommand(template)
+	db.Parser.BindParameters(cmd, params)
+	if err := db.checkParamTypes(cmd); err != nil {
+		return nil, err
 	}
 
+	return db.execCommand(cmd)
+}
+
+// execCommand runs an already-parsed and bound Command. It is the shared tail
+// of Query and Stmt.Exec/Query, so a prepared statement's repeated calls never
+// re-tokenize or re-parse the SQL text.
+func (db *SawitDB) execCommand(cmd *parser.Command) (interface{}, error) {
 	defer func() {
 		if r := recover(); r != nil {
 			// Catch panic
@@ -59,10 +134,20 @@ func (db *SawitDB) Query(queryString string, params map[string]interface{}) (int
 		return db.showTables()
 	case "SHOW_INDEXES":
 		return db.showIndexes(cmd.Table)
+	case "SHOW_CACHE":
+		return db.Pager.CacheStats(), nil
 	case "INSERT":
-		return db.insert(cmd.Table, cmd.Data)
+		return db.withTableLock(cmd.Table, func() (interface{}, error) {
+			return db.insertRows(cmd.Table, cmd.Rows)
+		})
 	case "SELECT":
-		rows, err := db._select(cmd.Table, cmd.Criteria, cmd.Sort, cmd.Limit, cmd.Offset)
+		var rows []map[string]interface{}
+		var err error
+		if len(cmd.Joins) > 0 {
+			rows, err = db.selectJoin(cmd)
+		} else {
+			rows, err = db._select(cmd.Table, cmd.Criteria, cmd.Sort, cmd.Limit, cmd.Offset)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -92,15 +177,25 @@ func (db *SawitDB) Query(queryString string, params map[string]interface{}) (int
 		return projected, nil
 
 	case "DELETE":
-		return db.delete(cmd.Table, cmd.Criteria)
+		return db.withTableLock(cmd.Table, func() (interface{}, error) {
+			return db.delete(cmd.Table, cmd.Criteria)
+		})
 	case "UPDATE":
-		return db.update(cmd.Table, cmd.Updates, cmd.Criteria)
+		return db.withTableLock(cmd.Table, func() (interface{}, error) {
+			return db.update(cmd.Table, cmd.Updates, cmd.Criteria)
+		})
 	case "DROP_TABLE":
 		return db.dropTable(cmd.Table)
 	case "CREATE_INDEX":
-		return db.createIndex(cmd.Table, cmd.Field)
+		return db.createIndex(cmd.Table, cmd.Field, cmd.KeyType)
+	case "REINDEX":
+		return db.reindex(cmd.Table)
 	case "AGGREGATE":
-		return db.aggregate(cmd.Table, cmd.Func, cmd.Field, cmd.Criteria, cmd.GroupBy)
+		return db.aggregate(cmd)
+	case "TX_BEGIN", "TX_COMMIT", "TX_ROLLBACK":
+		return nil, errors.New("Transaksi memerlukan koneksi: gunakan db.Begin() / tx.Commit() / tx.Rollback()")
+	case "SUBSCRIBE":
+		return nil, errors.New("LANGGAN/SUBSCRIBE memerlukan koneksi streaming: gunakan db.Subscribe()")
 	default:
 		return nil, errors.New("Perintah tidak dikenal atau belum diimplementasikan")
 	}
@@ -181,7 +276,7 @@ func (db *SawitDB) createTable(name string) (string, error) {
 	numTables := binary.LittleEndian.Uint32(p0[8:])
 
 	offset := 12 + (int(numTables) * 40)
-	if offset+40 > storage.PAGE_SIZE {
+	if offset+40 > storage.IndexDirPageOffset {
 		return "", errors.New("Lahan penuh (Page 0 full)")
 	}
 
@@ -190,21 +285,39 @@ func (db *SawitDB) createTable(name string) (string, error) {
 		return "", err
 	}
 
-	// Write name
-	copy(p0[offset:], name)
-	// Write Pages
-	binary.LittleEndian.PutUint32(p0[offset+32:], newPageId)
-	binary.LittleEndian.PutUint32(p0[offset+36:], newPageId)
+	if err := db.writeTableEntry(name, newPageId, newPageId); err != nil {
+		return "", err
+	}
 
-	// Update count
-	binary.LittleEndian.PutUint32(p0[8:], numTables+1)
+	return fmt.Sprintf("Kebun '%s' telah dibuka.", name), nil
+}
 
-	err = db.Pager.WritePage(0, p0)
+// writeTableEntry appends a new page-0 directory entry for name, pointing at
+// an already-allocated startPage/lastPage. Shared by createTable, whose
+// pages are a single freshly allocated empty page, and Repair, which
+// reattaches an existing orphaned page chain under a synthetic name -
+// rereads page 0 itself rather than taking it as an argument, since
+// createTable's caller must do the same after AllocPage: AllocPage already
+// wrote its own TotalPages bump to page 0, so writing back an earlier copy
+// would stomp that update and hand the next AllocPage call a page ID
+// already owned by this table.
+func (db *SawitDB) writeTableEntry(name string, startPage, lastPage uint32) error {
+	p0, err := db.Pager.ReadPage(0)
 	if err != nil {
-		return "", err
+		return err
+	}
+	numTables := binary.LittleEndian.Uint32(p0[8:])
+	offset := 12 + (int(numTables) * 40)
+	if offset+40 > storage.IndexDirPageOffset {
+		return errors.New("Lahan penuh (Page 0 full)")
 	}
 
-	return fmt.Sprintf("Kebun '%s' telah dibuka.", name), nil
+	copy(p0[offset:], name)
+	binary.LittleEndian.PutUint32(p0[offset+32:], startPage)
+	binary.LittleEndian.PutUint32(p0[offset+36:], lastPage)
+	binary.LittleEndian.PutUint32(p0[8:], numTables+1)
+
+	return db.Pager.WriteMutation("CREATE_TABLE", name, map[uint32][]byte{0: p0})
 }
 
 func (db *SawitDB) dropTable(name string) (string, error) {
@@ -235,35 +348,34 @@ func (db *SawitDB) dropTable(name string) (string, error) {
 	}
 
 	binary.LittleEndian.PutUint32(p0[8:], numTables-1)
-	err = db.Pager.WritePage(0, p0)
-	if err != nil {
+	if err := db.Pager.WriteMutation("DROP_TABLE", name, map[uint32][]byte{0: p0}); err != nil {
 		return "", err
 	}
 
 	return fmt.Sprintf("Kebun '%s' telah dibakar (Drop).", name), nil
 }
 
-func (db *SawitDB) updateTableLastPage(name string, newLastPageId uint32) error {
-	entry, err := db.findTableEntry(name)
-	if err != nil {
-		return err
-	}
-	if entry == nil {
-		return errors.New("Internal Error: Table missing for update")
-	}
-
-	p0, err := db.Pager.ReadPage(0)
-	if err != nil {
-		return err
-	}
-	binary.LittleEndian.PutUint32(p0[entry.Offset+36:], newLastPageId)
-	return db.Pager.WritePage(0, p0)
+// insertRows writes a batch of rows under a single write/lock/fsync instead of
+// one fsync per row. Every page touched by the batch is staged in memory first;
+// nothing is written to disk until every row has been validated and laid out,
+// so a failure on any tuple leaves the file completely untouched.
+func (db *SawitDB) insertRows(table string, rows []map[string]interface{}) (string, error) {
+	return db.insertRowsNotify(table, rows, true, "")
 }
 
-func (db *SawitDB) insert(table string, data map[string]interface{}) (string, error) {
-	if len(data) == 0 {
+// insertRowsNotify is insertRows with a notify flag, so updateTx (which does
+// its write as an internal delete+insert) can suppress the INSERT event and
+// publish a single UPDATE event itself instead. txID tags the WAL entry with
+// the transaction this write belongs to, or "" outside a transaction.
+func (db *SawitDB) insertRowsNotify(table string, rows []map[string]interface{}, notify bool, txID string) (string, error) {
+	if len(rows) == 0 {
 		return "", errors.New("Data kosong")
 	}
+	for idx, data := range rows {
+		if len(data) == 0 {
+			return "", fmt.Errorf("Tuple %d: Data kosong", idx)
+		}
+	}
 
 	entry, err := db.findTableEntry(table)
 	if err != nil {
@@ -273,67 +385,150 @@ func (db *SawitDB) insert(table string, data map[string]interface{}) (string, er
 		return "", fmt.Errorf("Kebun '%s' tidak ditemukan.", table)
 	}
 
-	dataBytes, err := json.Marshal(data)
+	page0, err := db.Pager.ReadPage(0)
 	if err != nil {
 		return "", err
 	}
+	totalPages := binary.LittleEndian.Uint32(page0[4:])
 
-	recordLen := len(dataBytes)
-	totalLen := 2 + recordLen
+	// Staged page buffers; nothing here is written to disk until every row
+	// below has been validated and placed.
+	pages := make(map[uint32][]byte)
+	loadPage := func(id uint32) ([]byte, error) {
+		if buf, ok := pages[id]; ok {
+			return buf, nil
+		}
+		buf, err := db.Pager.ReadPage(id)
+		if err != nil {
+			return nil, err
+		}
+		cp := make([]byte, len(buf))
+		copy(cp, buf)
+		pages[id] = cp
+		return cp, nil
+	}
 
 	currentPageId := entry.LastPage
-	pData, err := db.Pager.ReadPage(currentPageId)
+	pData, err := loadPage(currentPageId)
 	if err != nil {
 		return "", err
 	}
 
-	freeOffset := binary.LittleEndian.Uint16(pData[6:])
+	for idx, data := range rows {
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return "", fmt.Errorf("Tuple %d: %v", idx, err)
+		}
+		uncompressedLen := len(dataBytes)
 
-	if int(freeOffset)+totalLen > storage.PAGE_SIZE {
-		newPageId, err := db.Pager.AllocPage()
+		storedBytes, err := storage.Compress(db.compression, dataBytes)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("Tuple %d: %v", idx, err)
 		}
 
-		// Set Next Page of current
-		binary.LittleEndian.PutUint32(pData[0:], newPageId)
-		db.Pager.WritePage(currentPageId, pData)
+		recordLen := len(storedBytes)
+		totalLen := recHeaderLen + recordLen
+		if 8+totalLen > storage.UsablePageSize {
+			return "", fmt.Errorf("Tuple %d: record melebihi ukuran satu halaman", idx)
+		}
 
-		currentPageId = newPageId
-		pData, err = db.Pager.ReadPage(currentPageId)
-		if err != nil {
-			return "", err
+		freeOffset := binary.LittleEndian.Uint16(pData[6:])
+		if int(freeOffset)+totalLen > storage.UsablePageSize {
+			newPageId := totalPages
+			totalPages++
+
+			// Link current page to the freshly allocated one.
+			binary.LittleEndian.PutUint32(pData[0:], newPageId)
+
+			newPage := make([]byte, storage.PAGE_SIZE)
+			binary.LittleEndian.PutUint16(newPage[6:], 8) // Free Offset = 8
+			pages[newPageId] = newPage
+
+			currentPageId = newPageId
+			pData = newPage
+			freeOffset = 8
 		}
-		freeOffset = binary.LittleEndian.Uint16(pData[6:])
 
-		db.updateTableLastPage(table, currentPageId)
-	}
+		writeRecordHeader(pData[freeOffset:], uint16(recordLen), db.nextSeq(), 0, db.compression, uint16(uncompressedLen))
+		copy(pData[freeOffset+recHeaderLen:], storedBytes)
 
-	binary.LittleEndian.PutUint16(pData[freeOffset:], uint16(recordLen))
-	copy(pData[freeOffset+2:], dataBytes)
+		count := binary.LittleEndian.Uint16(pData[4:])
+		binary.LittleEndian.PutUint16(pData[4:], count+1)
+		binary.LittleEndian.PutUint16(pData[6:], freeOffset+uint16(totalLen))
 
-	count := binary.LittleEndian.Uint16(pData[4:])
-	binary.LittleEndian.PutUint16(pData[4:], count+1)
-	binary.LittleEndian.PutUint16(pData[6:], freeOffset+uint16(totalLen))
+		pages[currentPageId] = pData
+	}
 
-	err = db.Pager.WritePage(currentPageId, pData)
-	if err != nil {
+	binary.LittleEndian.PutUint32(page0[4:], totalPages)
+	if currentPageId != entry.LastPage {
+		binary.LittleEndian.PutUint32(page0[entry.Offset+36:], currentPageId)
+	}
+	pages[0] = page0
+
+	if err := db.Pager.WriteMutationTx(txID, "INSERT", table, pages); err != nil {
 		return "", err
 	}
 
-	// Indexes
-	db.updateIndexes(table, data)
+	for _, data := range rows {
+		db.updateIndexes(table, data)
+	}
+
+	if notify {
+		for _, data := range rows {
+			db.cdc.publish("INSERT", table, nil, data)
+		}
+	}
 
-	return "Bibit tertanam.", nil
+	if len(rows) == 1 {
+		return "Bibit tertanam.", nil
+	}
+	return fmt.Sprintf("%d bibit tertanam.", len(rows)), nil
+}
+
+// lookupIndex returns the B-Tree index for the exact "table.field" key, if
+// one exists - a single locked read so callers never range over db.Indexes
+// themselves just to check one key.
+func (db *SawitDB) lookupIndex(indexKey string) (*index.BTreeIndex, bool) {
+	db.indexMu.RLock()
+	defer db.indexMu.RUnlock()
+	idx, ok := db.Indexes[indexKey]
+	return idx, ok
 }
 
 func (db *SawitDB) updateIndexes(table string, data map[string]interface{}) {
+	db.indexMu.RLock()
+	defer db.indexMu.RUnlock()
+	for indexKey, index := range db.Indexes {
+		parts := strings.Split(indexKey, ".")
+		if parts[0] == table {
+			field := parts[1]
+			if val, ok := data[field]; ok {
+				key, err := indexKeyFor(index, val)
+				if err != nil {
+					continue
+				}
+				index.Insert(key, data)
+			}
+		}
+	}
+}
+
+// removeFromIndexes drops data's entry from every index on table, so a
+// deleted or superseded (update's delete-then-insert) row doesn't linger in
+// an index after it stops matching anything on disk.
+func (db *SawitDB) removeFromIndexes(table string, data map[string]interface{}) {
+	db.indexMu.RLock()
+	defer db.indexMu.RUnlock()
 	for indexKey, index := range db.Indexes {
 		parts := strings.Split(indexKey, ".")
 		if parts[0] == table {
 			field := parts[1]
 			if val, ok := data[field]; ok {
-				index.Insert(val, data)
+				key, err := indexKeyFor(index, val)
+				if err != nil {
+					continue
+				}
+				index.Delete(key, data)
 			}
 		}
 	}
@@ -471,6 +666,17 @@ func toFloat(i interface{}) (float64, bool) {
 }
 
 func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *parser.Sort, limit, offset *int) ([]map[string]interface{}, error) {
+	return db._selectAsOf(table, criteria, sortOpt, limit, offset, nil)
+}
+
+// _selectAsOf is _select pinned to a point-in-time view: asOf nil means
+// "every record visible right now" (the ordinary, non-snapshot case seen by
+// _select and everything else in the package); non-nil restricts it to a
+// Snapshot's sequence number, so records created or tombstoned afterward are
+// invisible. The B-Tree index fast path only covers the "right now" case -
+// the index carries no per-record history, so a snapshot read always falls
+// back to a full scan.
+func (db *SawitDB) _selectAsOf(table string, criteria *parser.Criteria, sortOpt *parser.Sort, limit, offset *int, asOf *uint64) ([]map[string]interface{}, error) {
 	entry, err := db.findTableEntry(table)
 	if err != nil {
 		return nil, err
@@ -483,18 +689,20 @@ func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *par
 
 	// Optimization: If Index exists and criteria is simple '=' and no sort
 	useIndex := false
-	if criteria != nil && criteria.Type == "" && criteria.Op == "=" && sortOpt == nil {
+	if asOf == nil && criteria != nil && criteria.Type == "" && criteria.Op == "=" && sortOpt == nil {
 		indexKey := fmt.Sprintf("%s.%s", table, criteria.Key)
-		if idx, ok := db.Indexes[indexKey]; ok {
+		if idx, ok := db.lookupIndex(indexKey); ok {
 			// Found index
 			useIndex = true
 			results = []map[string]interface{}{}
 			// Search returns []interface{}. We expect they are map[string]interface{} (the rows)
-			// In Insert, we perform: index.Insert(val, data). data IS the row map.
-			matched := idx.Search(criteria.Val)
-			for _, m := range matched {
-				if r, ok := m.(map[string]interface{}); ok {
-					results = append(results, r)
+			// In Insert, we perform: index.Insert(key, data). data IS the row map.
+			if key, err := indexKeyFor(idx, criteria.Val); err == nil {
+				matched := idx.Search(key)
+				for _, m := range matched {
+					if r, ok := m.(map[string]interface{}); ok {
+						results = append(results, r)
+					}
 				}
 			}
 		}
@@ -502,19 +710,23 @@ func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *par
 
 	if !useIndex {
 		// Full scan
-		results, err = db.scanTable(entry, criteria)
+		results, err = db.scanTable(entry, criteria, asOf)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Sort
+	return db.applySortLimit(results, sortOpt, limit, offset), nil
+}
+
+// applySortLimit orders and paginates an already-filtered result set. Split out
+// of _select so the transaction overlay in tx.go can apply the same ordering
+// rules to its locally-merged rows.
+func (db *SawitDB) applySortLimit(results []map[string]interface{}, sortOpt *parser.Sort, limit, offset *int) []map[string]interface{} {
 	if sortOpt != nil {
 		sort.Slice(results, func(i, j int) bool {
 			valA := results[i][sortOpt.Key]
 			valB := results[j][sortOpt.Key]
-			// Use comparison helper
-			// copy paste compare
 			af, aOk := toFloat(valA)
 			bf, bOk := toFloat(valB)
 			less := false
@@ -527,7 +739,6 @@ func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *par
 			if sortOpt.Dir == "asc" {
 				return less
 			}
-			// If desc, return greater (or !less if equal handling matters, but simple reversal)
 			if aOk && bOk {
 				return af > bf
 			}
@@ -535,7 +746,6 @@ func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *par
 		})
 	}
 
-	// Limit & Offset
 	startIndex := 0
 	endIndex := len(results)
 
@@ -547,16 +757,23 @@ func (db *SawitDB) _select(table string, criteria *parser.Criteria, sortOpt *par
 	}
 
 	if startIndex >= len(results) {
-		return []map[string]interface{}{}, nil
+		return []map[string]interface{}{}
 	}
 	if endIndex > len(results) {
 		endIndex = len(results)
 	}
 
-	return results[startIndex:endIndex], nil
+	return results[startIndex:endIndex]
 }
 
-func (db *SawitDB) scanTable(entry *TableEntry, criteria *parser.Criteria) ([]map[string]interface{}, error) {
+// scanTable walks table's page chain, decoding every record whose
+// (seq, delSeq) pair is visible as of asOf and matches criteria. asOf nil
+// means "as of right now": a record is visible once written and stays so
+// until tombstoned, regardless of seq. asOf non-nil pins the view to a
+// Snapshot's sequence number instead: a record is visible only if it was
+// written at or before that sequence and, if later tombstoned, only if the
+// tombstone itself is still in the future relative to asOf.
+func (db *SawitDB) scanTable(entry *TableEntry, criteria *parser.Criteria, asOf *uint64) ([]map[string]interface{}, error) {
 	results := []map[string]interface{}{}
 	currentPageId := entry.StartPage
 
@@ -570,17 +787,22 @@ func (db *SawitDB) scanTable(entry *TableEntry, criteria *parser.Criteria) ([]ma
 		offset := 8
 
 		for i := 0; i < int(count); i++ {
-			recLen := binary.LittleEndian.Uint16(pData[offset:])
-			jsonBytes := pData[offset+2 : offset+2+int(recLen)]
-
-			var obj map[string]interface{}
-			if err := json.Unmarshal(jsonBytes, &obj); err == nil {
-				if db.checkMatch(obj, criteria) {
-					results = append(results, obj)
+			recLen, seq, delSeq, compType, uncompressedLen := readRecordHeader(pData[offset:])
+			stored := pData[offset+recHeaderLen : offset+recHeaderLen+int(recLen)]
+
+			if recordVisible(seq, delSeq, asOf) {
+				jsonBytes, err := storage.Decompress(compType, stored, int(uncompressedLen))
+				if err == nil {
+					var obj map[string]interface{}
+					if err := json.Unmarshal(jsonBytes, &obj); err == nil {
+						if db.checkMatch(obj, criteria) {
+							results = append(results, obj)
+						}
+					}
 				}
 			}
 
-			offset += 2 + int(recLen)
+			offset += recHeaderLen + int(recLen)
 		}
 		currentPageId = binary.LittleEndian.Uint32(pData[0:])
 	}
@@ -588,6 +810,20 @@ func (db *SawitDB) scanTable(entry *TableEntry, criteria *parser.Criteria) ([]ma
 }
 
 func (db *SawitDB) delete(table string, criteria *parser.Criteria) (string, error) {
+	return db.deleteNotify(table, criteria, true, "")
+}
+
+// deleteNotify is delete with a notify flag, so updateTx (which does its write
+// as an internal delete+insert) can suppress the DELETE event and publish a
+// single UPDATE event itself instead. txID tags the WAL entry with the
+// transaction this write belongs to, or "" outside a transaction.
+//
+// Deletion is logical: a matching record is tombstoned in place (its delSeq
+// stamped with a fresh sequence number) rather than physically removed, so a
+// snapshot taken before this call still sees it. The bytes are only actually
+// reclaimed later, by reclaimTombstones, once no open snapshot can still
+// need them.
+func (db *SawitDB) deleteNotify(table string, criteria *parser.Criteria, notify bool, txID string) (string, error) {
 	entry, err := db.findTableEntry(table)
 	if err != nil {
 		return "", err
@@ -598,6 +834,8 @@ func (db *SawitDB) delete(table string, criteria *parser.Criteria) (string, erro
 
 	currentPageId := entry.StartPage
 	deletedCount := 0
+	var deleted []map[string]interface{}
+	pages := make(map[uint32][]byte)
 
 	for currentPageId != 0 {
 		pData, err := db.Pager.ReadPage(currentPageId)
@@ -607,59 +845,56 @@ func (db *SawitDB) delete(table string, criteria *parser.Criteria) (string, erro
 
 		count := binary.LittleEndian.Uint16(pData[4:])
 		offset := 8
-
-		type RecordCtx struct {
-			Len  int
-			Data []byte
-		}
-		recordsToKeep := []RecordCtx{}
+		touched := false
 
 		for i := 0; i < int(count); i++ {
-			recLen := int(binary.LittleEndian.Uint16(pData[offset:]))
-			jsonBytes := pData[offset+2 : offset+2+recLen]
-
-			shouldDelete := false
-			var obj map[string]interface{}
-			if err := json.Unmarshal(jsonBytes, &obj); err == nil {
-				if db.checkMatch(obj, criteria) {
-					shouldDelete = true
+			recLen, seq, delSeq, compType, uncompressedLen := readRecordHeader(pData[offset:])
+			stored := pData[offset+recHeaderLen : offset+recHeaderLen+int(recLen)]
+
+			if delSeq == 0 {
+				jsonBytes, err := storage.Decompress(compType, stored, int(uncompressedLen))
+				if err == nil {
+					var obj map[string]interface{}
+					if err := json.Unmarshal(jsonBytes, &obj); err == nil {
+						if db.checkMatch(obj, criteria) {
+							writeRecordHeader(pData[offset:], recLen, seq, db.nextSeq(), compType, uncompressedLen)
+							touched = true
+							deletedCount++
+							deleted = append(deleted, obj)
+						}
+					}
 				}
 			}
-
-			if shouldDelete {
-				deletedCount++
-			} else {
-				recordsToKeep = append(recordsToKeep, RecordCtx{
-					Len:  recLen,
-					Data: pData[offset+2 : offset+2+recLen], // Safe slice? Copy if needed
-				})
-			}
-			offset += 2 + recLen
+			offset += recHeaderLen + int(recLen)
 		}
 
-		if len(recordsToKeep) < int(count) {
-			writeOffset := 8
-			binary.LittleEndian.PutUint16(pData[4:], uint16(len(recordsToKeep)))
-			for _, rec := range recordsToKeep {
-				binary.LittleEndian.PutUint16(pData[writeOffset:], uint16(rec.Len))
-				copy(pData[writeOffset+2:], rec.Data)
-				writeOffset += 2 + rec.Len
-			}
-			binary.LittleEndian.PutUint16(pData[6:], uint16(writeOffset))
+		if touched {
+			pages[currentPageId] = pData
+		}
+		currentPageId = binary.LittleEndian.Uint32(pData[0:])
+	}
 
-			// Zero out rest
-			for k := writeOffset; k < storage.PAGE_SIZE; k++ {
-				pData[k] = 0
-			}
+	if len(pages) > 0 {
+		if err := db.Pager.WriteMutationTx(txID, "DELETE", table, pages); err != nil {
+			return "", err
+		}
+	}
 
-			db.Pager.WritePage(currentPageId, pData)
+	for _, obj := range deleted {
+		db.removeFromIndexes(table, obj)
+		if notify {
+			db.cdc.publish("DELETE", table, obj, nil)
 		}
-		currentPageId = binary.LittleEndian.Uint32(pData[0:])
 	}
 
 	return fmt.Sprintf("Berhasil menggusur %d bibit.", deletedCount), nil
 }
 
+// update applies updates to every row matching criteria as a single
+// WriteBatch, so the delete-and-reinsert it does internally either lands
+// entirely or not at all - unlike updateTx, which tags its writes with a
+// transaction id for Tx.Commit and so can't route through a batch (see
+// batch.go).
 func (db *SawitDB) update(table string, updates map[string]interface{}, criteria *parser.Criteria) (string, error) {
 	records, err := db._select(table, criteria, nil, nil, nil)
 	if err != nil {
@@ -669,21 +904,47 @@ func (db *SawitDB) update(table string, updates map[string]interface{}, criteria
 		return "Tidak ada bibit yang cocok untuk dipupuk.", nil
 	}
 
+	batch := db.Batch()
+	batch.Update(table, updates, criteria)
+	if err := batch.Commit(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Berhasil memupuk %d bibit.", len(records)), nil
+}
+
+// updateTx is update with the originating transaction's id, so the delete
+// and insert it performs internally tag their WAL entries with it too.
+func (db *SawitDB) updateTx(table string, updates map[string]interface{}, criteria *parser.Criteria, txID string) (string, error) {
+	records, err := db._select(table, criteria, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "Tidak ada bibit yang cocok untuk dipupuk.", nil
+	}
+
 	// Inefficient: Delete then Insert
-	db.delete(table, criteria)
+	db.deleteNotify(table, criteria, false, txID)
 
 	count := 0
 	for _, rec := range records {
+		before := cloneRow(rec)
 		for k, v := range updates {
 			rec[k] = v
 		}
-		db.insert(table, rec)
+		db.insertRowsNotify(table, []map[string]interface{}{rec}, false, txID)
+		db.cdc.publish("UPDATE", table, before, rec)
 		count++
 	}
 	return fmt.Sprintf("Berhasil memupuk %d bibit.", count), nil
 }
 
-func (db *SawitDB) createIndex(table string, field string) (string, error) {
+// createIndex persists (table, field, keyType) to the index directory in
+// addition to building the B-Tree in memory, so NewSawitDB can rebuild it
+// automatically on the next open instead of the index silently disappearing
+// at restart. keyType is "" for the default comparator, or e.g. "BYTES" to
+// build the index over an order-preserving byte encoding instead.
+func (db *SawitDB) createIndex(table string, field string, keyType string) (string, error) {
 	entry, err := db.findTableEntry(table)
 	if err != nil {
 		return "", err
@@ -693,27 +954,27 @@ func (db *SawitDB) createIndex(table string, field string) (string, error) {
 	}
 
 	indexKey := fmt.Sprintf("%s.%s", table, field)
-	if _, ok := db.Indexes[indexKey]; ok {
+	if _, ok := db.lookupIndex(indexKey); ok {
 		return fmt.Sprintf("Indeks pada '%s' sudah ada.", indexKey), nil
 	}
 
-	index := index.NewBTreeIndex(32)
-	index.Name = indexKey
-	index.KeyField = field
-
-	// Build
-	records, _ := db._select(table, nil, nil, nil, nil) // All
-	for _, rec := range records {
-		if val, ok := rec[field]; ok {
-			index.Insert(val, rec)
-		}
+	idx, err := db.buildIndex(table, field, keyType)
+	if err != nil {
+		return "", err
+	}
+	if err := db.persistIndexDef(table, field, keyType); err != nil {
+		return "", err
 	}
 
-	db.Indexes[indexKey] = index
-	return fmt.Sprintf("Indeks dibuat pada '%s' (%d records indexed)", indexKey, len(records)), nil
+	db.indexMu.Lock()
+	db.Indexes[indexKey] = idx
+	db.indexMu.Unlock()
+	return fmt.Sprintf("Indeks dibuat pada '%s' (%d records indexed)", indexKey, idx.Stats()["keyCount"].(int)), nil
 }
 
 func (db *SawitDB) showIndexes(table string) (interface{}, error) {
+	db.indexMu.RLock()
+	defer db.indexMu.RUnlock()
 	if table != "" {
 		res := []interface{}{}
 		for key, idx := range db.Indexes {
@@ -733,20 +994,38 @@ func (db *SawitDB) showIndexes(table string) (interface{}, error) {
 	return res, nil
 }
 
-func (db *SawitDB) aggregate(table string, fn string, field string, criteria *parser.Criteria, groupBy string) (interface{}, error) {
-	records, err := db._select(table, criteria, nil, nil, nil)
+func (db *SawitDB) aggregate(cmd *parser.Command) (interface{}, error) {
+	records, err := db._select(cmd.Table, cmd.Criteria, nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
+	return db.aggregateRecords(records, cmd)
+}
 
-	if groupBy != "" {
-		return db.groupedAggregate(records, fn, field, groupBy), nil
+// aggregateRecords runs an aggregate function over an already-fetched record
+// set. Split out of aggregate so the transaction overlay in tx.go can
+// aggregate its locally-merged rows the same way.
+func (db *SawitDB) aggregateRecords(records []map[string]interface{}, cmd *parser.Command) (interface{}, error) {
+	if len(cmd.GroupBy) > 0 {
+		return db.groupedAggregate(records, cmd), nil
 	}
 
+	fn := strings.ToUpper(cmd.Func)
+	field := cmd.Field
+
 	// Simple aggregate
-	switch strings.ToUpper(fn) {
+	switch fn {
 	case "COUNT":
+		if cmd.Distinct {
+			seen := map[string]bool{}
+			for _, r := range records {
+				seen[fmt.Sprintf("%v", r[field])] = true
+			}
+			return map[string]int{"count": len(seen)}, nil
+		}
 		return map[string]int{"count": len(records)}, nil
+	case "GROUP_CONCAT":
+		return db.concatField(records, cmd), nil
 	case "SUM":
 		sum := 0.0
 		for _, r := range records {
@@ -796,27 +1075,64 @@ func (db *SawitDB) aggregate(table string, fn string, field string, criteria *pa
 	return nil, errors.New("Unknown aggregate function")
 }
 
-func (db *SawitDB) groupedAggregate(records []map[string]interface{}, fn, field, groupBy string) interface{} {
-	groups := make(map[interface{}][]map[string]interface{})
+// groupEntry accumulates the rows belonging to one composite group-by key,
+// alongside the actual (unstringified) values of the grouping columns.
+type groupEntry struct {
+	keys map[string]interface{}
+	rows []map[string]interface{}
+}
+
+func (db *SawitDB) groupedAggregate(records []map[string]interface{}, cmd *parser.Command) interface{} {
+	fn := strings.ToUpper(cmd.Func)
+	field := cmd.Field
+	groupBy := cmd.GroupBy
+
+	groups := make(map[string]*groupEntry)
+	order := []string{}
 
 	for _, r := range records {
-		key := r[groupBy] // Can be nil or any type
-		// Map key must be comparable. interface{} is comparable if underlying type is.
-		// JSON numbers are float64. Strings are string.
-		// Slices/maps are not comparable. Assuming groupBy is scalar.
-		groups[key] = append(groups[key], r)
+		keyParts := make([]string, len(groupBy))
+		keys := make(map[string]interface{}, len(groupBy))
+		for gi, g := range groupBy {
+			v := r[g]
+			keys[g] = v
+			keyParts[gi] = fmt.Sprintf("%v", v)
+		}
+		// Slices/maps aren't comparable, so group on a stringified composite
+		// key rather than the raw values (assumed scalar per grouping column).
+		compositeKey := strings.Join(keyParts, "\x1f")
+
+		entry, ok := groups[compositeKey]
+		if !ok {
+			entry = &groupEntry{keys: keys}
+			groups[compositeKey] = entry
+			order = append(order, compositeKey)
+		}
+		entry.rows = append(entry.rows, r)
 	}
 
 	results := []map[string]interface{}{}
-	for key, group := range groups {
-		res := map[string]interface{}{groupBy: key}
+	for _, ck := range order {
+		entry := groups[ck]
+		res := map[string]interface{}{}
+		for k, v := range entry.keys {
+			res[k] = v
+		}
 
-		switch strings.ToUpper(fn) {
+		switch fn {
 		case "COUNT":
-			res["count"] = len(group)
+			if cmd.Distinct {
+				seen := map[string]bool{}
+				for _, r := range entry.rows {
+					seen[fmt.Sprintf("%v", r[field])] = true
+				}
+				res["count"] = len(seen)
+			} else {
+				res["count"] = len(entry.rows)
+			}
 		case "SUM":
 			sum := 0.0
-			for _, r := range group {
+			for _, r := range entry.rows {
 				if v, ok := toFloat(r[field]); ok {
 					sum += v
 				}
@@ -824,18 +1140,18 @@ func (db *SawitDB) groupedAggregate(records []map[string]interface{}, fn, field,
 			res["sum"] = sum
 		case "AVG":
 			sum := 0.0
-			for _, r := range group {
+			for _, r := range entry.rows {
 				if v, ok := toFloat(r[field]); ok {
 					sum += v
 				}
 			}
 			res["avg"] = 0.0
-			if len(group) > 0 {
-				res["avg"] = sum / float64(len(group))
+			if len(entry.rows) > 0 {
+				res["avg"] = sum / float64(len(entry.rows))
 			}
 		case "MIN":
 			minVal := math.Inf(1)
-			for _, r := range group {
+			for _, r := range entry.rows {
 				if v, ok := toFloat(r[field]); ok {
 					if v < minVal {
 						minVal = v
@@ -845,7 +1161,7 @@ func (db *SawitDB) groupedAggregate(records []map[string]interface{}, fn, field,
 			res["min"] = minVal
 		case "MAX":
 			maxVal := math.Inf(-1)
-			for _, r := range group {
+			for _, r := range entry.rows {
 				if v, ok := toFloat(r[field]); ok {
 					if v > maxVal {
 						maxVal = v
@@ -853,8 +1169,136 @@ func (db *SawitDB) groupedAggregate(records []map[string]interface{}, fn, field,
 				}
 			}
 			res["max"] = maxVal
+		case "GROUP_CONCAT":
+			res["group_concat"] = db.concatValues(entry.rows, cmd)
+		}
+
+		// HAVING may filter on a different aggregate than the one HITUNG
+		// selected (e.g. "KELOMPOK x PUNYA COUNT(*) > 1" alongside
+		// GROUP_CONCAT). Fill in whichever basic aggregates weren't already
+		// computed above so checkMatch can find them.
+		if cmd.Having != nil {
+			fillHavingAggregates(res, entry.rows, cmd.Having)
+		}
+
+		if cmd.Having == nil || db.checkMatch(res, cmd.Having) {
+			results = append(results, res)
 		}
-		results = append(results, res)
 	}
 	return results
 }
+
+// fillHavingAggregates computes every aggregate a HAVING clause checks that
+// isn't already present in res, recursing into compound conditions. Each
+// leaf condition carries its own Fn/Field (see parser.parseHaving), so a
+// HAVING clause can filter on a different field - or a different function
+// entirely - than the one HITUNG's SELECT clause aggregates on.
+func fillHavingAggregates(res map[string]interface{}, rows []map[string]interface{}, having *parser.Criteria) {
+	if having.Type == "compound" {
+		for _, cond := range having.Conditions {
+			fillHavingAggregates(res, rows, cond)
+		}
+		return
+	}
+	if _, ok := res[having.Key]; ok {
+		return
+	}
+	res[having.Key] = computeAggregate(having.Fn, having.Field, rows)
+}
+
+// computeAggregate evaluates one aggregate function over rows for fn/field,
+// the same functions aggregate (above) computes for a top-level HITUNG, but
+// callable for an arbitrary field rather than only cmd.Field.
+func computeAggregate(fn, field string, rows []map[string]interface{}) interface{} {
+	switch strings.ToUpper(fn) {
+	case "COUNT":
+		if field == "" || field == "*" {
+			return len(rows)
+		}
+		count := 0
+		for _, r := range rows {
+			if v, ok := r[field]; ok && v != nil {
+				count++
+			}
+		}
+		return count
+	case "SUM":
+		sum := 0.0
+		for _, r := range rows {
+			if v, ok := toFloat(r[field]); ok {
+				sum += v
+			}
+		}
+		return sum
+	case "AVG":
+		sum, n := 0.0, 0
+		for _, r := range rows {
+			if v, ok := toFloat(r[field]); ok {
+				sum += v
+				n++
+			}
+		}
+		if n == 0 {
+			return 0.0
+		}
+		return sum / float64(n)
+	case "MIN":
+		minVal := math.Inf(1)
+		found := false
+		for _, r := range rows {
+			if v, ok := toFloat(r[field]); ok {
+				found = true
+				if v < minVal {
+					minVal = v
+				}
+			}
+		}
+		if !found {
+			return 0.0
+		}
+		return minVal
+	case "MAX":
+		maxVal := math.Inf(-1)
+		found := false
+		for _, r := range rows {
+			if v, ok := toFloat(r[field]); ok {
+				found = true
+				if v > maxVal {
+					maxVal = v
+				}
+			}
+		}
+		if !found {
+			return 0.0
+		}
+		return maxVal
+	default:
+		return nil
+	}
+}
+
+// concatField computes a GROUP_CONCAT over an ungrouped (whole-table) result.
+func (db *SawitDB) concatField(records []map[string]interface{}, cmd *parser.Command) map[string]interface{} {
+	return map[string]interface{}{"group_concat": db.concatValues(records, cmd), "field": cmd.Field}
+}
+
+// concatValues joins cmd.Field across rows, honouring GROUP_CONCAT's optional
+// ORDER BY and SEPARATOR clauses.
+func (db *SawitDB) concatValues(rows []map[string]interface{}, cmd *parser.Command) string {
+	if cmd.ConcatOrderKey != "" {
+		rows = db.applySortLimit(rows, &parser.Sort{Key: cmd.ConcatOrderKey, Dir: cmd.ConcatOrderDir}, nil, nil)
+	}
+
+	parts := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if v, ok := r[cmd.Field]; ok && v != nil {
+			parts = append(parts, fmt.Sprintf("%v", v))
+		}
+	}
+
+	sep := cmd.ConcatSeparator
+	if sep == "" {
+		sep = ","
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/index"
+	"github.com/WowoEngine/SawitDB-Go/internal/storage"
+	"strings"
+)
+
+// indexDirEntrySize is one index definition's on-disk footprint: a 32-byte
+// table name, a 32-byte field name, and a 32-byte key-type tag (e.g.
+// "BYTES", empty for the default comparator), the same fixed-width layout
+// the table directory in page 0 uses for its own entries.
+const indexDirEntrySize = 32 + 32 + 32
+
+type indexDef struct {
+	Table   string
+	Field   string
+	KeyType string
+}
+
+// indexKeyFor converts val into the key form idx expects: Encode'd bytes
+// for a BYTES-typed index, val itself otherwise.
+func indexKeyFor(idx *index.BTreeIndex, val interface{}) (interface{}, error) {
+	if idx.KeyType == "BYTES" {
+		return index.Encode(val)
+	}
+	return val, nil
+}
+
+// indexDirRoot returns the first page of the index directory chain, or 0 if
+// no index has ever been created.
+func (db *SawitDB) indexDirRoot() (uint32, error) {
+	page0, err := db.Pager.ReadPage(0)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(page0[storage.IndexDirPageOffset:]), nil
+}
+
+func (db *SawitDB) setIndexDirRoot(pageId uint32) error {
+	page0, err := db.Pager.ReadPage(0)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(page0[storage.IndexDirPageOffset:], pageId)
+	return db.Pager.WriteMutation("INDEX_DIR_ROOT", "", map[uint32][]byte{0: page0})
+}
+
+// readIndexDefs walks the index directory chain, returning every persisted
+// index definition in the order they were created.
+func (db *SawitDB) readIndexDefs() ([]indexDef, error) {
+	root, err := db.indexDirRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []indexDef
+	currentPageId := root
+	for currentPageId != 0 {
+		pData, err := db.Pager.ReadPage(currentPageId)
+		if err != nil {
+			return nil, err
+		}
+		count := binary.LittleEndian.Uint16(pData[4:])
+		offset := 8
+		for i := 0; i < int(count); i++ {
+			table := strings.TrimRight(string(pData[offset:offset+32]), "\x00")
+			field := strings.TrimRight(string(pData[offset+32:offset+64]), "\x00")
+			keyType := strings.TrimRight(string(pData[offset+64:offset+96]), "\x00")
+			defs = append(defs, indexDef{Table: table, Field: field, KeyType: keyType})
+			offset += indexDirEntrySize
+		}
+		currentPageId = binary.LittleEndian.Uint32(pData[0:])
+	}
+	return defs, nil
+}
+
+// persistIndexDef appends (table, field, keyType) to the index directory,
+// allocating its first page - or a new chain page, once the last one fills
+// up.
+func (db *SawitDB) persistIndexDef(table, field, keyType string) error {
+	root, err := db.indexDirRoot()
+	if err != nil {
+		return err
+	}
+
+	if root == 0 {
+		newPageId, err := db.Pager.AllocPage()
+		if err != nil {
+			return err
+		}
+		if err := db.setIndexDirRoot(newPageId); err != nil {
+			return err
+		}
+		root = newPageId
+	}
+
+	currentPageId := root
+	var pData []byte
+	for {
+		pData, err = db.Pager.ReadPage(currentPageId)
+		if err != nil {
+			return err
+		}
+		next := binary.LittleEndian.Uint32(pData[0:])
+		count := binary.LittleEndian.Uint16(pData[4:])
+		if next == 0 && 8+(int(count)+1)*indexDirEntrySize <= storage.UsablePageSize {
+			break
+		}
+		if next == 0 {
+			newPageId, err := db.Pager.AllocPage()
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(pData[0:], newPageId)
+			if err := db.Pager.WriteMutation("INDEX_DIR", table, map[uint32][]byte{currentPageId: pData}); err != nil {
+				return err
+			}
+			currentPageId = newPageId
+			continue
+		}
+		currentPageId = next
+	}
+
+	count := binary.LittleEndian.Uint16(pData[4:])
+	offset := 8 + int(count)*indexDirEntrySize
+	copy(pData[offset:], table)
+	copy(pData[offset+32:], field)
+	copy(pData[offset+64:], keyType)
+	binary.LittleEndian.PutUint16(pData[4:], count+1)
+
+	return db.Pager.WriteMutation("INDEX_DIR", table, map[uint32][]byte{currentPageId: pData})
+}
+
+// buildIndex runs a full table scan to construct idxKey's B-Tree from
+// scratch, without touching the persisted index directory or db.Indexes -
+// the caller decides when the result becomes visible. keyType selects the
+// comparator: "BYTES" binds index.BytesComparator and encodes every key
+// with index.Encode, "" uses index.DefaultComparator with keys as-is.
+func (db *SawitDB) buildIndex(table, field, keyType string) (*index.BTreeIndex, error) {
+	var idx *index.BTreeIndex
+	if keyType == "BYTES" {
+		idx = index.NewBTreeIndexWithComparator(32, index.BytesComparator)
+	} else {
+		idx = index.NewBTreeIndex(32)
+	}
+	idx.Name = fmt.Sprintf("%s.%s", table, field)
+	idx.KeyField = field
+	idx.KeyType = keyType
+
+	records, err := db._select(table, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		val, ok := rec[field]
+		if !ok {
+			continue
+		}
+		key, err := indexKeyFor(idx, val)
+		if err != nil {
+			continue
+		}
+		idx.Insert(key, rec)
+	}
+	return idx, nil
+}
+
+// recoverIndexes rebuilds every persisted index definition's B-Tree in
+// memory at startup. Index contents are never themselves persisted - only
+// the (table, field) definitions are - so this is the same full-table-scan
+// rebuild createIndex does, run once per definition found.
+func (db *SawitDB) recoverIndexes() error {
+	defs, err := db.readIndexDefs()
+	if err != nil {
+		return err
+	}
+	for _, def := range defs {
+		idx, err := db.buildIndex(def.Table, def.Field, def.KeyType)
+		if err != nil {
+			return err
+		}
+		db.indexMu.Lock()
+		db.Indexes[fmt.Sprintf("%s.%s", def.Table, def.Field)] = idx
+		db.indexMu.Unlock()
+	}
+	return nil
+}
+
+// reindex rebuilds table's indexes from scratch in the background: each
+// B-Tree is built fresh off to the side, and only swapped into db.Indexes
+// once done, so queries keep serving from the old tree for the rebuild's
+// entire duration instead of seeing a partially-populated one.
+func (db *SawitDB) reindex(table string) (string, error) {
+	defs, err := db.readIndexDefs()
+	if err != nil {
+		return "", err
+	}
+
+	var matched []indexDef
+	for _, def := range defs {
+		if def.Table == table {
+			matched = append(matched, def)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Sprintf("Kebun '%s' tidak memiliki indeks.", table), nil
+	}
+
+	for _, def := range matched {
+		def := def
+		go func() {
+			idx, err := db.buildIndex(def.Table, def.Field, def.KeyType)
+			if err != nil {
+				return
+			}
+			db.indexMu.Lock()
+			db.Indexes[fmt.Sprintf("%s.%s", def.Table, def.Field)] = idx
+			db.indexMu.Unlock()
+		}()
+	}
+
+	return fmt.Sprintf("Pembangunan ulang %d indeks pada '%s' dimulai di latar belakang.", len(matched), table), nil
+}
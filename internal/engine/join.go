@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"strings"
+)
+
+// selectJoin executes cmd.Table together with its Joins, producing rows whose
+// keys are namespaced "table.field" so identically named columns from either
+// side never collide. Criteria, Sort and Limit/Offset are applied to the
+// already-joined result, the same as a plain SELECT.
+func (db *SawitDB) selectJoin(cmd *parser.Command) ([]map[string]interface{}, error) {
+	left, err := db.scanQualified(cmd.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, j := range cmd.Joins {
+		right, err := db.scanQualified(j.Table)
+		if err != nil {
+			return nil, err
+		}
+		left, err = db.joinRows(left, right, j)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.Criteria != nil {
+		filtered := make([]map[string]interface{}, 0, len(left))
+		for _, r := range left {
+			if db.checkMatch(r, cmd.Criteria) {
+				filtered = append(filtered, r)
+			}
+		}
+		left = filtered
+	}
+
+	return db.applySortLimit(left, cmd.Sort, cmd.Limit, cmd.Offset), nil
+}
+
+// scanQualified reads every row of table and renames its fields to
+// "table.field", so rows from two tables can be merged without their columns
+// colliding.
+func (db *SawitDB) scanQualified(table string) ([]map[string]interface{}, error) {
+	rows, err := db._select(table, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	qualified := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		q := make(map[string]interface{}, len(r))
+		for k, v := range r {
+			q[fmt.Sprintf("%s.%s", table, k)] = v
+		}
+		qualified[i] = q
+	}
+	return qualified, nil
+}
+
+// resolveJoinKeys figures out which of j.LeftKey/j.RightKey actually names a
+// column on right (qualified with j.Table) and which names a column already
+// in scope on left, since PADA/ON doesn't require writing them in
+// DARI/GABUNG order - "PADA karet.id = sawit.karet_id" is exactly as valid
+// as "PADA sawit.karet_id = karet.id". Resolving by qualifier instead of
+// position means the side each key is checked against tracks which table it
+// was actually written against, not which position in the PADA clause it
+// happened to be typed in.
+func resolveJoinKeys(j parser.JoinSpec) (leftKey, rightKey string, err error) {
+	prefix := j.Table + "."
+	leftKeyIsRight := strings.HasPrefix(j.LeftKey, prefix)
+	rightKeyIsRight := strings.HasPrefix(j.RightKey, prefix)
+
+	switch {
+	case rightKeyIsRight && !leftKeyIsRight:
+		return j.LeftKey, j.RightKey, nil
+	case leftKeyIsRight && !rightKeyIsRight:
+		return j.RightKey, j.LeftKey, nil
+	default:
+		return "", "", fmt.Errorf("PADA/ON tidak jelas: tidak bisa menentukan sisi '%s' dan '%s' untuk GABUNG '%s'", j.LeftKey, j.RightKey, j.Table)
+	}
+}
+
+// joinRows matches left (already-qualified rows accumulated from the tables
+// joined so far) against right (the table named by j) on leftKey = rightKey,
+// resolved from j.LeftKey/j.RightKey by resolveJoinKeys rather than assumed
+// from PADA/ON order. It picks a hash join when right's join key has a
+// B-Tree index - db.Indexes is keyed exactly like the qualified field name,
+// "table.field" - and falls back to a nested loop otherwise, mirroring the
+// "use the index if there is one" rule _select already applies to a plain
+// WHERE.
+func (db *SawitDB) joinRows(left, right []map[string]interface{}, j parser.JoinSpec) ([]map[string]interface{}, error) {
+	leftKey, rightKey, err := resolveJoinKeys(j)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []map[string]interface{}{}
+	rightNulls := nullRow(right)
+
+	if _, hasIndex := db.lookupIndex(rightKey); hasIndex {
+		buckets := make(map[interface{}][]map[string]interface{}, len(right))
+		for _, r := range right {
+			k := r[rightKey]
+			buckets[k] = append(buckets[k], r)
+		}
+		for _, l := range left {
+			matches := buckets[l[leftKey]]
+			if len(matches) == 0 {
+				if j.Type == "LEFT" {
+					out = append(out, mergeRow(l, rightNulls))
+				}
+				continue
+			}
+			for _, r := range matches {
+				out = append(out, mergeRow(l, r))
+			}
+		}
+		return out, nil
+	}
+
+	for _, l := range left {
+		matched := false
+		for _, r := range right {
+			if l[leftKey] == r[rightKey] {
+				out = append(out, mergeRow(l, r))
+				matched = true
+			}
+		}
+		if !matched && j.Type == "LEFT" {
+			out = append(out, mergeRow(l, rightNulls))
+		}
+	}
+	return out, nil
+}
+
+// nullRow builds a NULL-valued row shaped like sample's rows, for padding out
+// the right side of a LEFT JOIN that found no match. SawitDB has no column
+// schema beyond the rows actually inserted, so an empty right table pads with
+// nothing - there is nothing to learn column names from.
+func nullRow(sample []map[string]interface{}) map[string]interface{} {
+	if len(sample) == 0 {
+		return map[string]interface{}{}
+	}
+	row := make(map[string]interface{}, len(sample[0]))
+	for k := range sample[0] {
+		row[k] = nil
+	}
+	return row
+}
+
+func mergeRow(l, r map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(l)+len(r))
+	for k, v := range l {
+		out[k] = v
+	}
+	for k, v := range r {
+		out[k] = v
+	}
+	return out
+}
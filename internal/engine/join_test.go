@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newJoinTestDB(t *testing.T) *SawitDB {
+	t.Helper()
+	db, err := NewSawitDB(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("NewSawitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mustQuery(t, db, "LAHAN sawit")
+	mustQuery(t, db, "LAHAN karet")
+	mustQuery(t, db, "TANAM KE karet (id, jenis) BIBIT (10, 'GT1')")
+	mustQuery(t, db, "TANAM KE karet (id, jenis) BIBIT (11, 'PB260')")
+	mustQuery(t, db, "TANAM KE sawit (id, karet_id) BIBIT (1, 10)")
+	mustQuery(t, db, "TANAM KE sawit (id, karet_id) BIBIT (2, 11)")
+	mustQuery(t, db, "TANAM KE sawit (id, karet_id) BIBIT (3, 999)") // no matching karet row
+	return db
+}
+
+func TestInnerJoinOnSharedKey(t *testing.T) {
+	db := newJoinTestDB(t)
+
+	res := mustQuery(t, db, "PANEN * DARI sawit GABUNG karet PADA sawit.karet_id = karet.id")
+	rows, ok := res.([]map[string]interface{})
+	if !ok {
+		t.Fatalf("expected rows, got %T", res)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 matching rows, got %d: %+v", len(rows), rows)
+	}
+	for _, r := range rows {
+		if _, ok := r["karet.jenis"]; !ok {
+			t.Errorf("expected a qualified karet.jenis column, got %+v", r)
+		}
+	}
+}
+
+// TestJoinKeyOrderIndependence guards against resolving join keys by their
+// position in PADA/ON rather than by which table they're actually qualified
+// with - flipping the clause must not change the result.
+func TestJoinKeyOrderIndependence(t *testing.T) {
+	db := newJoinTestDB(t)
+
+	forward := mustQuery(t, db, "PANEN * DARI sawit GABUNG karet PADA sawit.karet_id = karet.id").([]map[string]interface{})
+	reversed := mustQuery(t, db, "PANEN * DARI sawit GABUNG karet PADA karet.id = sawit.karet_id").([]map[string]interface{})
+
+	if len(forward) != len(reversed) {
+		t.Fatalf("flipping PADA order changed row count: %d vs %d", len(forward), len(reversed))
+	}
+	if len(forward) != 2 {
+		t.Fatalf("expected 2 rows regardless of PADA order, got %d", len(forward))
+	}
+}
+
+func TestLeftJoinPadsUnmatchedRightSideWithNull(t *testing.T) {
+	db := newJoinTestDB(t)
+
+	res := mustQuery(t, db, "PANEN * DARI sawit KIRI GABUNG karet PADA sawit.karet_id = karet.id")
+	rows, ok := res.([]map[string]interface{})
+	if !ok {
+		t.Fatalf("expected rows, got %T", res)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected all 3 sawit rows via LEFT JOIN, got %d: %+v", len(rows), rows)
+	}
+
+	var unmatched map[string]interface{}
+	for _, r := range rows {
+		if r["sawit.id"] == float64(3) {
+			unmatched = r
+		}
+	}
+	if unmatched == nil {
+		t.Fatalf("expected the unmatched sawit row (id=3) to still be present")
+	}
+	if v, ok := unmatched["karet.jenis"]; !ok || v != nil {
+		t.Errorf("expected karet.jenis to be NULL-padded for the unmatched row, got %+v (present=%v)", v, ok)
+	}
+}
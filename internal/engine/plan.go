@@ -0,0 +1,55 @@
+package engine
+
+import "github.com/WowoEngine/SawitDB-Go/internal/parser"
+
+// QueryPlan is a lightweight summary of how Query executed a statement -
+// enough for a sampled trace log line (see internal/log and
+// SawitServer.Config.TraceSampleRate) to explain what a query actually did
+// without the caller unpacking a parser.Command itself.
+type QueryPlan struct {
+	Type    string
+	Table   string
+	Joins   int
+	HasSort bool
+	Limit   *int
+	Offset  *int
+}
+
+func planFromCommand(cmd *parser.Command) *QueryPlan {
+	return &QueryPlan{
+		Type:    cmd.Type,
+		Table:   cmd.Table,
+		Joins:   len(cmd.Joins),
+		HasSort: cmd.Sort != nil,
+		Limit:   cmd.Limit,
+		Offset:  cmd.Offset,
+	}
+}
+
+// QueryWithPlan behaves exactly like Query, but also returns a QueryPlan
+// describing the statement that ran. It's a separate method rather than a
+// new return value on Query itself so the common case - every existing
+// caller - doesn't have to change to ignore a plan it never asked for.
+func (db *SawitDB) QueryWithPlan(queryString string, params map[string]interface{}) (interface{}, *QueryPlan, error) {
+	if isBlockQuery(queryString) {
+		res, err := db.execBlock(queryString, params)
+		return res, nil, err
+	}
+
+	template, err := db.plans.getOrParse(db.Parser, queryString)
+	if err != nil {
+		return nil, nil, err
+	}
+	if template.Type == "EMPTY" {
+		return "", nil, nil
+	}
+
+	cmd := cloneCommand(template)
+	db.Parser.BindParameters(cmd, params)
+	if err := db.checkParamTypes(cmd); err != nil {
+		return nil, nil, err
+	}
+
+	res, err := db.execCommand(cmd)
+	return res, planFromCommand(cmd), err
+}
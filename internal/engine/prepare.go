@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"sync"
+)
+
+// planCache holds parsed-but-unbound Command templates keyed by their raw SQL
+// text, so ad-hoc callers that run the same statement repeatedly (and Query
+// itself) skip re-tokenizing and re-parsing. It evicts the least recently
+// used entry once it grows past its capacity.
+type planCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	entries  map[string]*list.Element
+}
+
+type planCacheEntry struct {
+	sql string
+	cmd *parser.Command
+}
+
+func newPlanCache(capacity int) *planCache {
+	return &planCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// getOrParse returns the cached template for sql, parsing and caching it on a
+// miss. Templates are never bound in place - callers must cloneCommand before
+// filling in ParamRef values, so the same template can be reused concurrently.
+func (pc *planCache) getOrParse(qp *parser.QueryParser, sql string) (*parser.Command, error) {
+	pc.mu.Lock()
+	if el, ok := pc.entries[sql]; ok {
+		pc.order.MoveToFront(el)
+		cmd := el.Value.(*planCacheEntry).cmd
+		pc.mu.Unlock()
+		return cmd, nil
+	}
+	pc.mu.Unlock()
+
+	cmd := qp.Parse(sql, nil)
+	if cmd.Type == "ERROR" {
+		return nil, errors.New(cmd.Message)
+	}
+	if cmd.Type == "EMPTY" {
+		return cmd, nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if el, ok := pc.entries[sql]; ok {
+		pc.order.MoveToFront(el)
+		return el.Value.(*planCacheEntry).cmd, nil
+	}
+	el := pc.order.PushFront(&planCacheEntry{sql: sql, cmd: cmd})
+	pc.entries[sql] = el
+	if pc.order.Len() > pc.capacity {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*planCacheEntry).sql)
+	}
+	return cmd, nil
+}
+
+// cloneCommand deep-copies a Command template so binding ParamRef values for
+// one call can never leak into the cached template or a concurrent caller.
+func cloneCommand(src *parser.Command) *parser.Command {
+	dst := *src
+
+	if src.Cols != nil {
+		dst.Cols = append([]string(nil), src.Cols...)
+	}
+	if src.GroupBy != nil {
+		dst.GroupBy = append([]string(nil), src.GroupBy...)
+	}
+	if src.Joins != nil {
+		dst.Joins = append([]parser.JoinSpec(nil), src.Joins...)
+	}
+	if src.Limit != nil {
+		v := *src.Limit
+		dst.Limit = &v
+	}
+	if src.Offset != nil {
+		v := *src.Offset
+		dst.Offset = &v
+	}
+	if src.Sort != nil {
+		s := *src.Sort
+		dst.Sort = &s
+	}
+	if src.Data != nil {
+		dst.Data = cloneRow(src.Data)
+	}
+	if src.Rows != nil {
+		rows := make([]map[string]interface{}, len(src.Rows))
+		for i, r := range src.Rows {
+			rows[i] = cloneRow(r)
+		}
+		dst.Rows = rows
+		if len(rows) == 1 {
+			dst.Data = rows[0]
+		}
+	}
+	if src.Updates != nil {
+		dst.Updates = cloneRow(src.Updates)
+	}
+	dst.Criteria = cloneCriteria(src.Criteria)
+	dst.Having = cloneCriteria(src.Having)
+
+	return &dst
+}
+
+func cloneRow(src map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func cloneCriteria(src *parser.Criteria) *parser.Criteria {
+	if src == nil {
+		return nil
+	}
+	dst := *src
+	if src.Conditions != nil {
+		conds := make([]*parser.Criteria, len(src.Conditions))
+		for i, c := range src.Conditions {
+			conds[i] = cloneCriteria(c)
+		}
+		dst.Conditions = conds
+	}
+	if arr, ok := src.Val.([]interface{}); ok {
+		dst.Val = append([]interface{}(nil), arr...)
+	}
+	return &dst
+}
+
+// Stmt is a query template parsed once by Prepare. Exec and Query clone the
+// template and bind args without re-tokenizing or re-parsing the SQL text.
+// Both methods behave identically - SawitDB.Query already handles reads and
+// writes through a single entry point, so Stmt mirrors that rather than
+// splitting on statement type.
+type Stmt struct {
+	db  *SawitDB
+	cmd *parser.Command
+}
+
+// Prepare parses sql into a reusable template, consulting the plan cache so
+// preparing the same text twice is free.
+func (db *SawitDB) Prepare(sql string) (*Stmt, error) {
+	cmd, err := db.plans.getOrParse(db.Parser, sql)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{db: db, cmd: cmd}, nil
+}
+
+// Exec binds args (by @name, or by the decimal string of a ? placeholder's
+// position, e.g. "0") against the template and runs it.
+func (s *Stmt) Exec(args map[string]interface{}) (interface{}, error) {
+	if s.cmd.Type == "EMPTY" {
+		return "", nil
+	}
+	cmd := cloneCommand(s.cmd)
+	s.db.Parser.BindParameters(cmd, args)
+	if err := s.db.checkParamTypes(cmd); err != nil {
+		return nil, err
+	}
+	return s.db.execCommand(cmd)
+}
+
+// Query is an alias for Exec, kept distinct for callers used to a
+// read/write-shaped prepared-statement API.
+func (s *Stmt) Query(args map[string]interface{}) (interface{}, error) {
+	return s.Exec(args)
+}
+
+// checkParamTypes rejects a bound value whose type is incompatible with a
+// field that already has a B-Tree index built over it - e.g. binding a string
+// where every existing indexed key is numeric. It only has an existing
+// sample to compare against, so an index with no entries yet can't catch a
+// mismatch this way.
+func (db *SawitDB) checkParamTypes(cmd *parser.Command) error {
+	if cmd.Criteria == nil && cmd.Having == nil {
+		return nil
+	}
+	if err := db.checkCriteriaTypes(cmd.Table, cmd.Criteria); err != nil {
+		return err
+	}
+	return db.checkCriteriaTypes(cmd.Table, cmd.Having)
+}
+
+func (db *SawitDB) checkCriteriaTypes(table string, c *parser.Criteria) error {
+	if c == nil {
+		return nil
+	}
+	if c.Type == "compound" {
+		for _, sub := range c.Conditions {
+			if err := db.checkCriteriaTypes(table, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	idx, ok := db.lookupIndex(fmt.Sprintf("%s.%s", table, c.Key))
+	if !ok {
+		return nil
+	}
+	if idx.KeyType != "" {
+		// Keys are stored Encode'd (e.g. BYTES), so the sample's Go type no
+		// longer reflects the field's own type - Encode accepts whatever it
+		// can and indexKeyFor already skips values it can't, so there's
+		// nothing useful left to compare here.
+		return nil
+	}
+	sample, ok := idx.SampleKey()
+	if !ok {
+		return nil
+	}
+
+	vals, ok := c.Val.([]interface{})
+	if !ok {
+		vals = []interface{}{c.Val}
+	}
+	for _, v := range vals {
+		if v == nil {
+			continue
+		}
+		if !sameKind(sample, v) {
+			return fmt.Errorf("tipe data tidak sesuai untuk '%s.%s': indeks menyimpan %T, diberikan %T", table, c.Key, sample, v)
+		}
+	}
+	return nil
+}
+
+func sameKind(a, b interface{}) bool {
+	_, aNum := toFloat(a)
+	_, bNum := toFloat(b)
+	if aNum || bNum {
+		return aNum == bNum
+	}
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if aStr || bStr {
+		return aStr == bStr
+	}
+	return true
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"github.com/WowoEngine/SawitDB-Go/internal/storage"
+)
+
+// recHeaderLen is the per-record header stored ahead of every row's bytes on
+// a data page: a 2-byte stored length, two 8-byte sequence numbers - seq,
+// the write that created this version, and delSeq, the write that
+// tombstoned it (0 if it hasn't been) - then a 1-byte CompressionType and a
+// 2-byte uncompressed length. The sequence numbers mirror goleveldb's
+// scheme closely enough that a record's visibility to a given point in time
+// is a pure function of the two numbers - see recordVisible. The
+// compression fields let each record carry whichever codec was configured
+// when it was written, so reopening a database under different
+// Options.Compression still reads older rows correctly.
+const recHeaderLen = 2 + 8 + 8 + 1 + 2
+
+func writeRecordHeader(buf []byte, recLen uint16, seq, delSeq uint64, compType storage.CompressionType, uncompressedLen uint16) {
+	binary.LittleEndian.PutUint16(buf[0:], recLen)
+	binary.LittleEndian.PutUint64(buf[2:], seq)
+	binary.LittleEndian.PutUint64(buf[10:], delSeq)
+	buf[18] = byte(compType)
+	binary.LittleEndian.PutUint16(buf[19:], uncompressedLen)
+}
+
+func readRecordHeader(buf []byte) (recLen uint16, seq, delSeq uint64, compType storage.CompressionType, uncompressedLen uint16) {
+	recLen = binary.LittleEndian.Uint16(buf[0:])
+	seq = binary.LittleEndian.Uint64(buf[2:])
+	delSeq = binary.LittleEndian.Uint64(buf[10:])
+	compType = storage.CompressionType(buf[18])
+	uncompressedLen = binary.LittleEndian.Uint16(buf[19:])
+	return
+}
+
+// recordVisible decides whether a record written at seq and (if non-zero)
+// tombstoned at delSeq is visible as of asOf. asOf nil means "right now":
+// every written record is visible until tombstoned, full stop. asOf
+// non-nil pins the check to a Snapshot's sequence number instead, so a
+// record is visible only if it existed by then and, should it later have
+// been tombstoned, only if that tombstone is itself still in the future
+// relative to asOf.
+func recordVisible(seq, delSeq uint64, asOf *uint64) bool {
+	if asOf == nil {
+		return delSeq == 0
+	}
+	return seq <= *asOf && (delSeq == 0 || delSeq > *asOf)
+}
+
+// nextSeq hands out the sequence number for a new write - an insert's
+// creation, or a delete's tombstone.
+func (db *SawitDB) nextSeq() uint64 {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+	db.seq++
+	return db.seq
+}
+
+func (db *SawitDB) currentSeq() uint64 {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+	return db.seq
+}
+
+// oldestLiveSeq returns the sequence number of the oldest open snapshot, and
+// whether one exists at all.
+func (db *SawitDB) oldestLiveSeq() (uint64, bool) {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+	front := db.snapshots.Front()
+	if front == nil {
+		return 0, false
+	}
+	return front.Value.(*Snapshot).Seq, true
+}
+
+// recoverSeq scans every table's raw records for the highest sequence number
+// already on disk, so a reopened database resumes numbering from there
+// instead of reissuing sequence numbers a crash-recovered record already
+// has.
+func (db *SawitDB) recoverSeq() error {
+	tables, err := db.showTables()
+	if err != nil {
+		return err
+	}
+
+	var maxSeq uint64
+	for _, name := range tables {
+		entry, err := db.findTableEntry(name)
+		if err != nil || entry == nil {
+			continue
+		}
+
+		currentPageId := entry.StartPage
+		for currentPageId != 0 {
+			pData, err := db.Pager.ReadPage(currentPageId)
+			if err != nil {
+				return err
+			}
+
+			count := binary.LittleEndian.Uint16(pData[4:])
+			offset := 8
+			for i := 0; i < int(count); i++ {
+				recLen, seq, delSeq, _, _ := readRecordHeader(pData[offset:])
+				if seq > maxSeq {
+					maxSeq = seq
+				}
+				if delSeq > maxSeq {
+					maxSeq = delSeq
+				}
+				offset += recHeaderLen + int(recLen)
+			}
+			currentPageId = binary.LittleEndian.Uint32(pData[0:])
+		}
+	}
+
+	db.seq = maxSeq
+	return nil
+}
+
+// reclaimTombstones physically drops every tombstoned record no open
+// snapshot can still need, across every table. A record is safe to drop
+// once its delSeq is at or before the oldest open snapshot's sequence
+// number - that snapshot, and therefore every newer one, already considers
+// it deleted - or, with no snapshots open at all, unconditionally.
+func (db *SawitDB) reclaimTombstones() error {
+	belowSeq, hasSnapshot := db.oldestLiveSeq()
+
+	tables, err := db.showTables()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tables {
+		entry, err := db.findTableEntry(name)
+		if err != nil || entry == nil {
+			continue
+		}
+
+		pages := make(map[uint32][]byte)
+		currentPageId := entry.StartPage
+
+		for currentPageId != 0 {
+			pData, err := db.Pager.ReadPage(currentPageId)
+			if err != nil {
+				return err
+			}
+
+			count := binary.LittleEndian.Uint16(pData[4:])
+			offset := 8
+
+			type keptRecord struct {
+				seq, delSeq     uint64
+				compType        storage.CompressionType
+				uncompressedLen uint16
+				data            []byte
+			}
+			var kept []keptRecord
+
+			for i := 0; i < int(count); i++ {
+				recLen, seq, delSeq, compType, uncompressedLen := readRecordHeader(pData[offset:])
+				stored := pData[offset+recHeaderLen : offset+recHeaderLen+int(recLen)]
+
+				drop := delSeq != 0 && (!hasSnapshot || delSeq <= belowSeq)
+				if !drop {
+					data := make([]byte, len(stored))
+					copy(data, stored)
+					kept = append(kept, keptRecord{seq: seq, delSeq: delSeq, compType: compType, uncompressedLen: uncompressedLen, data: data})
+				}
+				offset += recHeaderLen + int(recLen)
+			}
+
+			if len(kept) < int(count) {
+				writeOffset := 8
+				for _, rec := range kept {
+					writeRecordHeader(pData[writeOffset:], uint16(len(rec.data)), rec.seq, rec.delSeq, rec.compType, rec.uncompressedLen)
+					copy(pData[writeOffset+recHeaderLen:], rec.data)
+					writeOffset += recHeaderLen + len(rec.data)
+				}
+				binary.LittleEndian.PutUint16(pData[4:], uint16(len(kept)))
+				binary.LittleEndian.PutUint16(pData[6:], uint16(writeOffset))
+				for k := writeOffset; k < storage.PAGE_SIZE; k++ {
+					pData[k] = 0
+				}
+				pages[currentPageId] = pData
+			}
+			currentPageId = binary.LittleEndian.Uint32(pData[0:])
+		}
+
+		if len(pages) > 0 {
+			if err := db.Pager.WriteMutation("RECLAIM", name, pages); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot is a consistent, point-in-time view of the database, unaffected
+// by whatever concurrent INSERT/UPDATE/DELETE calls run after it was taken.
+// Every record on disk carries the sequence number it was written at, and
+// the one it was tombstoned at if it has been; Query only sees records that
+// existed, and weren't yet tombstoned, as of Seq. The caller must call
+// Release once done with it - an open snapshot holds back reclaimTombstones
+// from dropping rows it might still need.
+type Snapshot struct {
+	db   *SawitDB
+	Seq  uint64
+	elem *list.Element
+}
+
+// Snapshot opens a new view pinned to the database's current sequence
+// number.
+func (db *SawitDB) Snapshot() *Snapshot {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+
+	snap := &Snapshot{db: db, Seq: db.seq}
+	snap.elem = db.snapshots.PushBack(snap)
+	return snap
+}
+
+// Query runs a read-only statement (PANEN/SELECT or HITUNG/aggregate)
+// against the database exactly as it looked when the snapshot was taken.
+func (s *Snapshot) Query(queryString string, params map[string]interface{}) (interface{}, error) {
+	template, err := s.db.plans.getOrParse(s.db.Parser, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if template.Type == "EMPTY" {
+		return "", nil
+	}
+
+	cmd := cloneCommand(template)
+	s.db.Parser.BindParameters(cmd, params)
+	if err := s.db.checkParamTypes(cmd); err != nil {
+		return nil, err
+	}
+
+	asOf := s.Seq
+	switch cmd.Type {
+	case "SELECT":
+		return s.db.selectAsOfCommand(cmd, &asOf)
+	case "AGGREGATE":
+		records, err := s.db._selectAsOf(cmd.Table, cmd.Criteria, nil, nil, nil, &asOf)
+		if err != nil {
+			return nil, err
+		}
+		return s.db.aggregateRecords(records, cmd)
+	default:
+		return nil, errors.New("Snapshot hanya mendukung pembacaan (PANEN/HITUNG)")
+	}
+}
+
+// selectAsOfCommand is execCommand's SELECT case, pinned to asOf instead of
+// "right now". JOINs aren't supported through a Snapshot yet - selectJoin
+// always reads live - so cmd.Joins is rejected here rather than silently
+// ignored.
+func (db *SawitDB) selectAsOfCommand(cmd *parser.Command, asOf *uint64) (interface{}, error) {
+	if len(cmd.Joins) > 0 {
+		return nil, errors.New("Snapshot belum mendukung GABUNG/JOIN")
+	}
+
+	rows, err := db._selectAsOf(cmd.Table, cmd.Criteria, cmd.Sort, cmd.Limit, cmd.Offset, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.Cols) == 0 || (len(cmd.Cols) == 1 && cmd.Cols[0] == "*") {
+		return rows, nil
+	}
+
+	projected := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		newRow := make(map[string]interface{})
+		for _, c := range cmd.Cols {
+			if v, ok := r[c]; ok {
+				newRow[c] = v
+			}
+		}
+		projected[i] = newRow
+	}
+	return projected, nil
+}
+
+// Release closes the snapshot. If it was the oldest open one, releasing it
+// may be what lets reclaimTombstones drop tombstones no other open snapshot
+// still needs, so reclamation runs right away. Release is the only caller of
+// reclaimTombstones: no mutation triggers it, so tombstones stay on disk
+// until the oldest open snapshot is released.
+func (s *Snapshot) Release() {
+	s.db.seqMu.Lock()
+	wasOldest := s.db.snapshots.Front() == s.elem
+	s.db.snapshots.Remove(s.elem)
+	s.db.seqMu.Unlock()
+
+	if wasOldest {
+		s.db.reclaimTombstones()
+	}
+}
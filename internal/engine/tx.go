@@ -0,0 +1,327 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/WowoEngine/SawitDB-Go/internal/parser"
+	"sync"
+)
+
+// lockManager hands out table-level write locks to transactions. Locks are
+// acquired in whatever order a Tx touches tables; before blocking on a held
+// table, the requester's wait-for edge is checked for a cycle so that two
+// transactions waiting on each other fail fast instead of hanging forever.
+type lockManager struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	holders map[string]string // table -> holding tx id
+	waitFor map[string]string // tx id -> tx id it is waiting on
+}
+
+func newLockManager() *lockManager {
+	lm := &lockManager{
+		holders: make(map[string]string),
+		waitFor: make(map[string]string),
+	}
+	lm.cond = sync.NewCond(&lm.mu)
+	return lm
+}
+
+func (lm *lockManager) acquire(table, txID string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for {
+		holder, locked := lm.holders[table]
+		if !locked || holder == txID {
+			lm.holders[table] = txID
+			delete(lm.waitFor, txID)
+			return nil
+		}
+
+		lm.waitFor[txID] = holder
+		if lm.hasCycle(txID) {
+			delete(lm.waitFor, txID)
+			return fmt.Errorf("deadlock terdeteksi: transaksi %s menunggu '%s' yang dikunci oleh %s", txID, table, holder)
+		}
+		lm.cond.Wait()
+	}
+}
+
+// hasCycle walks the wait-for graph starting at start, returning true if it
+// leads back to start (i.e. a deadlock involving the requester exists).
+func (lm *lockManager) hasCycle(start string) bool {
+	seen := map[string]bool{}
+	cur := start
+	for {
+		next, ok := lm.waitFor[cur]
+		if !ok {
+			return false
+		}
+		if next == start {
+			return true
+		}
+		if seen[next] {
+			return false
+		}
+		seen[next] = true
+		cur = next
+	}
+}
+
+// withTableLock runs fn while holding table's write lock under a synthetic,
+// single-use id, so a plain (non-MULAI) INSERT/UPDATE/DELETE issued through
+// SawitDB.Query serializes against both other plain writes and any
+// in-flight transaction on the same table - the same lockMgr a Tx already
+// goes through via lockTable, just acquired and released around one
+// statement instead of held for a whole transaction.
+func (db *SawitDB) withTableLock(table string, fn func() (interface{}, error)) (interface{}, error) {
+	db.txMu.Lock()
+	db.txSeq++
+	id := fmt.Sprintf("plain-%d", db.txSeq)
+	db.txMu.Unlock()
+
+	if err := db.lockMgr.acquire(table, id); err != nil {
+		return nil, err
+	}
+	defer db.lockMgr.releaseAll(id)
+
+	return fn()
+}
+
+func (lm *lockManager) releaseAll(txID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for table, holder := range lm.holders {
+		if holder == txID {
+			delete(lm.holders, table)
+		}
+	}
+	delete(lm.waitFor, txID)
+	lm.cond.Broadcast()
+}
+
+// txOp is a single buffered mutation waiting to be replayed against real
+// storage at Commit time.
+type txOp struct {
+	kind     string // INSERT, UPDATE, DELETE
+	table    string
+	rows     []map[string]interface{}
+	updates  map[string]interface{}
+	criteria *parser.Criteria
+}
+
+// Tx is a handle to a buffered-write transaction. Writes made through a Tx are
+// held in memory (never touching the pager) until Commit is called, so a
+// Rollback - or a connection that simply disappears - leaves zero on-disk
+// trace. Reads made through the same Tx see its own uncommitted writes.
+type Tx struct {
+	ID     string
+	db     *SawitDB
+	ops    []txOp
+	locked map[string]bool
+}
+
+// Begin opens a new transaction. The returned Tx must be closed with either
+// Commit or Rollback, both of which release any table locks it acquired.
+func (db *SawitDB) Begin() *Tx {
+	db.txMu.Lock()
+	db.txSeq++
+	id := fmt.Sprintf("tx-%d", db.txSeq)
+	tx := &Tx{ID: id, db: db, locked: make(map[string]bool)}
+	db.txs[id] = tx
+	db.txMu.Unlock()
+	return tx
+}
+
+// Tx looks up a previously opened transaction by id, for wire-protocol
+// handlers that only carry the id across the connection.
+func (db *SawitDB) Tx(id string) (*Tx, bool) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+	tx, ok := db.txs[id]
+	return tx, ok
+}
+
+func (tx *Tx) lockTable(table string) error {
+	if tx.locked[table] {
+		return nil
+	}
+	if err := tx.db.lockMgr.acquire(table, tx.ID); err != nil {
+		return err
+	}
+	tx.locked[table] = true
+	return nil
+}
+
+func (tx *Tx) release() {
+	tx.db.lockMgr.releaseAll(tx.ID)
+	tx.db.txMu.Lock()
+	delete(tx.db.txs, tx.ID)
+	tx.db.txMu.Unlock()
+}
+
+// Query executes a single statement within the transaction. Writes are
+// buffered; reads see the table's committed rows with this transaction's own
+// buffered writes replayed on top.
+func (tx *Tx) Query(queryString string, params map[string]interface{}) (interface{}, error) {
+	template, err := tx.db.plans.getOrParse(tx.db.Parser, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if template.Type == "EMPTY" {
+		return "", nil
+	}
+
+	cmd := cloneCommand(template)
+	tx.db.Parser.BindParameters(cmd, params)
+	if err := tx.db.checkParamTypes(cmd); err != nil {
+		return nil, err
+	}
+
+	switch cmd.Type {
+	case "TX_BEGIN":
+		return nil, errors.New("Transaksi ini sudah berjalan")
+	case "TX_COMMIT":
+		return nil, errors.New("Gunakan tx.Commit(), bukan SIMPAN/COMMIT di dalam transaksi")
+	case "TX_ROLLBACK":
+		return nil, errors.New("Gunakan tx.Rollback(), bukan BATAL/ROLLBACK di dalam transaksi")
+
+	case "INSERT":
+		if err := tx.lockTable(cmd.Table); err != nil {
+			return nil, err
+		}
+		tx.ops = append(tx.ops, txOp{kind: "INSERT", table: cmd.Table, rows: cmd.Rows})
+		if len(cmd.Rows) == 1 {
+			return "Bibit tertanam (dalam transaksi).", nil
+		}
+		return fmt.Sprintf("%d bibit tertanam (dalam transaksi).", len(cmd.Rows)), nil
+
+	case "UPDATE":
+		if err := tx.lockTable(cmd.Table); err != nil {
+			return nil, err
+		}
+		tx.ops = append(tx.ops, txOp{kind: "UPDATE", table: cmd.Table, updates: cmd.Updates, criteria: cmd.Criteria})
+		return "Perubahan dicatat (dalam transaksi).", nil
+
+	case "DELETE":
+		if err := tx.lockTable(cmd.Table); err != nil {
+			return nil, err
+		}
+		tx.ops = append(tx.ops, txOp{kind: "DELETE", table: cmd.Table, criteria: cmd.Criteria})
+		return "Penghapusan dicatat (dalam transaksi).", nil
+
+	case "SELECT":
+		rows, err := tx.selectLocal(cmd.Table, cmd.Criteria, cmd.Sort, cmd.Limit, cmd.Offset)
+		if err != nil {
+			return nil, err
+		}
+		if len(cmd.Cols) == 0 || (len(cmd.Cols) == 1 && cmd.Cols[0] == "*") {
+			return rows, nil
+		}
+		projected := make([]map[string]interface{}, len(rows))
+		for i, r := range rows {
+			newRow := make(map[string]interface{})
+			for _, c := range cmd.Cols {
+				if v, ok := r[c]; ok {
+					newRow[c] = v
+				}
+			}
+			projected[i] = newRow
+		}
+		return projected, nil
+
+	case "AGGREGATE":
+		rows, err := tx.selectLocal(cmd.Table, cmd.Criteria, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return tx.db.aggregateRecords(rows, cmd)
+
+	default:
+		// DDL and other administrative commands are not staged; they run
+		// immediately against the shared database, same as outside a tx.
+		return tx.db.Query(queryString, params)
+	}
+}
+
+// selectLocal re-reads a table's committed rows and replays this
+// transaction's own buffered ops on top, in the order they were issued, so a
+// Tx observes its own writes without anything reaching the pager.
+func (tx *Tx) selectLocal(table string, criteria *parser.Criteria, sortOpt *parser.Sort, limit, offset *int) ([]map[string]interface{}, error) {
+	records, err := tx.db._select(table, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range tx.ops {
+		if op.table != table {
+			continue
+		}
+		switch op.kind {
+		case "INSERT":
+			records = append(records, op.rows...)
+		case "UPDATE":
+			for _, r := range records {
+				if tx.db.checkMatch(r, op.criteria) {
+					for k, v := range op.updates {
+						r[k] = v
+					}
+				}
+			}
+		case "DELETE":
+			kept := records[:0]
+			for _, r := range records {
+				if !tx.db.checkMatch(r, op.criteria) {
+					kept = append(kept, r)
+				}
+			}
+			records = kept
+		}
+	}
+
+	if criteria != nil {
+		filtered := make([]map[string]interface{}, 0, len(records))
+		for _, r := range records {
+			if tx.db.checkMatch(r, criteria) {
+				filtered = append(filtered, r)
+			}
+		}
+		records = filtered
+	}
+
+	return tx.db.applySortLimit(records, sortOpt, limit, offset), nil
+}
+
+// Commit replays every buffered write against real storage, in the order the
+// statements were issued, then releases the transaction's locks. A failure
+// partway through still releases the locks, leaving whatever prior ops in
+// this commit already landed on disk - SawitDB does not yet support undoing a
+// partially applied commit.
+func (tx *Tx) Commit() error {
+	defer tx.release()
+
+	for _, op := range tx.ops {
+		var err error
+		switch op.kind {
+		case "INSERT":
+			_, err = tx.db.insertRowsNotify(op.table, op.rows, true, tx.ID)
+		case "UPDATE":
+			_, err = tx.db.updateTx(op.table, op.updates, op.criteria, tx.ID)
+		case "DELETE":
+			_, err = tx.db.deleteNotify(op.table, op.criteria, true, tx.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback discards every buffered write and releases the transaction's
+// locks. Since writes are never applied until Commit, this leaves zero trace
+// on disk.
+func (tx *Tx) Rollback() error {
+	tx.release()
+	return nil
+}
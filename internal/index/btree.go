@@ -1,41 +1,82 @@
 package index
 
-// Simple B-Tree Index for SawitDB
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// BTreeNode is a node of a B+Tree: keys live only in leaves, each paired
+// with a bucket of values (so duplicate keys just grow the bucket instead
+// of needing a second leaf entry); internal nodes hold separator keys plus
+// child pointers and no values of their own. Leaves are threaded together
+// via Next/Prev so a range scan is one descent to the first leaf followed
+// by a linear walk across siblings, instead of a full-tree recursion.
 type BTreeNode struct {
 	IsLeaf   bool
 	Keys     []interface{}
-	Values   []interface{} // For leaf nodes: array of record references (or []interface{} if multiple)
-	Children []*BTreeNode  // For internal nodes
+	Values   [][]interface{} // leaf only: Values[i] is the bucket for Keys[i]
+	Children []*BTreeNode    // internal only: len(Children) == len(Keys)+1
+	Next     *BTreeNode      // leaf only: right sibling
+	Prev     *BTreeNode      // leaf only: left sibling
 }
 
 func NewBTreeNode(isLeaf bool) *BTreeNode {
-	return &BTreeNode{
-		IsLeaf:   isLeaf,
-		Keys:     make([]interface{}, 0),
-		Values:   make([]interface{}, 0),
-		Children: make([]*BTreeNode, 0),
+	n := &BTreeNode{IsLeaf: isLeaf, Keys: make([]interface{}, 0)}
+	if isLeaf {
+		n.Values = make([][]interface{}, 0)
+	} else {
+		n.Children = make([]*BTreeNode, 0)
 	}
+	return n
 }
 
+// Comparator orders two keys, returning <0, 0 or >0 for a<b, a==b, a>b.
+// BTreeIndex consults it for every key comparison instead of a single
+// hard-coded switch, so a tree can be built over any key shape the caller
+// can order - see DefaultComparator, BytesComparator and
+// CompositeComparator below.
+type Comparator func(a, b interface{}) int
+
 type BTreeIndex struct {
 	Order    int
 	Root     *BTreeNode
 	Name     string
 	KeyField string
+	KeyType  string // optional, caller-defined tag (e.g. "BYTES"); purely informational for BTreeIndex itself
+	Cmp      Comparator
 }
 
 func NewBTreeIndex(order int) *BTreeIndex {
+	return NewBTreeIndexWithComparator(order, DefaultComparator)
+}
+
+// NewBTreeIndexWithComparator is NewBTreeIndex, binding cmp instead of
+// DefaultComparator - e.g. BytesComparator for an index whose keys are
+// Encode'd byte strings, or a CompositeComparator for a multi-field key.
+func NewBTreeIndexWithComparator(order int, cmp Comparator) *BTreeIndex {
 	if order == 0 {
 		order = 32
 	}
 	return &BTreeIndex{
 		Order: order,
 		Root:  NewBTreeNode(true),
+		Cmp:   cmp,
 	}
 }
 
-// Helper for comparison
-func compare(a, b interface{}) int {
+// DefaultComparator orders ints, float64s (the two JSON-decoded numeric
+// types this codebase sees, plus a few exported helpers like Encode),
+// strings, and int/float64 mismatches numerically. Anything else compares
+// equal - silently, matching the original hard-coded compare this replaces -
+// so an index over a type DefaultComparator doesn't understand should be
+// built with a different Comparator (BytesComparator, CompositeComparator,
+// or a caller's own) instead of corrupting silently.
+func DefaultComparator(a, b interface{}) int {
 	switch v1 := a.(type) {
 	case int:
 		v2, ok := b.(int)
@@ -97,248 +138,558 @@ func compare(a, b interface{}) int {
 	}
 }
 
+// BytesComparator orders keys that are already []byte with bytes.Compare -
+// the comparator to pair with Encode, whose whole point is turning ints,
+// floats, strings and times into a []byte form that compares the same way
+// the original values do.
+func BytesComparator(a, b interface{}) int {
+	return bytes.Compare(a.([]byte), b.([]byte))
+}
+
+// FieldSpec describes one field's ordering within a CompositeComparator key.
+type FieldSpec struct {
+	Desc      bool // false = ascending
+	NullsLast bool // false = nil sorts before every non-nil value
+}
+
+// CompositeComparator returns a Comparator for tuple keys ([]interface{},
+// one element per field), comparing element-by-element under fields'
+// per-field ordering and stopping at the first field that differs - the
+// same semantics as a multi-column ORDER BY. A tuple missing a trailing
+// element is treated as nil for that field.
+func CompositeComparator(fields ...FieldSpec) Comparator {
+	return func(a, b interface{}) int {
+		ta, _ := a.([]interface{})
+		tb, _ := b.([]interface{})
+		for i, f := range fields {
+			var va, vb interface{}
+			if i < len(ta) {
+				va = ta[i]
+			}
+			if i < len(tb) {
+				vb = tb[i]
+			}
+			if c := compareField(va, vb, f); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+func compareField(a, b interface{}, f FieldSpec) int {
+	if a == nil && b == nil {
+		return 0
+	}
+	if a == nil {
+		if f.NullsLast {
+			return 1
+		}
+		return -1
+	}
+	if b == nil {
+		if f.NullsLast {
+			return -1
+		}
+		return 1
+	}
+	c := DefaultComparator(a, b)
+	if f.Desc {
+		return -c
+	}
+	return c
+}
+
+// Encode produces an order-preserving []byte encoding of key, for use with
+// BytesComparator: two keys compare the same way as their encodings do
+// under bytes.Compare. Ints are big-endian with the sign bit flipped so
+// negative values sort before positive ones; floats are IEEE-754 bits with
+// sign-mangling (flip every bit if negative, just the sign bit otherwise)
+// for the same reason; strings and []byte pass through unchanged, since
+// byte-wise order is already their natural order; time.Time encodes via its
+// UnixNano, through the same int encoding.
+func Encode(key interface{}) ([]byte, error) {
+	switch v := key.(type) {
+	case int:
+		return encodeInt(int64(v)), nil
+	case int64:
+		return encodeInt(v), nil
+	case float64:
+		return encodeFloat(v), nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case time.Time:
+		return encodeInt(v.UnixNano()), nil
+	default:
+		return nil, fmt.Errorf("index: cannot Encode key of type %T", key)
+	}
+}
+
+func encodeInt(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v)^(1<<63))
+	return buf
+}
+
+func encodeFloat(f float64) []byte {
+	bits := math.Float64bits(f)
+	if f >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
+}
+
+// Insert adds value under key, merging into key's existing bucket if the
+// key is already present instead of creating a second leaf entry.
 func (bt *BTreeIndex) Insert(key interface{}, value interface{}) {
-	root := bt.Root
-	if len(root.Keys) >= bt.Order {
+	promotedKey, newChild, split := bt.insertRec(bt.Root, key, value)
+	if split {
 		newRoot := NewBTreeNode(false)
-		newRoot.Children = append(newRoot.Children, bt.Root)
-		bt.splitChild(newRoot, 0)
+		newRoot.Keys = append(newRoot.Keys, promotedKey)
+		newRoot.Children = append(newRoot.Children, bt.Root, newChild)
 		bt.Root = newRoot
-		bt.insertNonFull(newRoot, key, value)
-	} else {
-		bt.insertNonFull(root, key, value)
 	}
 }
 
-func (bt *BTreeIndex) insertNonFull(node *BTreeNode, key interface{}, value interface{}) {
-	i := len(node.Keys) - 1
-
+// insertRec inserts key/value under node's subtree, splitting node if it
+// overflows (more than Order keys) afterward. When split is true, the
+// caller - node's parent, or Insert itself for the root - must absorb
+// promotedKey/newChild as a new separator and sibling child.
+func (bt *BTreeIndex) insertRec(node *BTreeNode, key, value interface{}) (promotedKey interface{}, newChild *BTreeNode, split bool) {
 	if node.IsLeaf {
-		// Insert key-value in sorted order
-		// Expand slices
-		node.Keys = append(node.Keys, nil)
-		node.Values = append(node.Values, nil)
-
-		// Shift
-		for i >= 0 && compare(key, node.Keys[i]) < 0 {
-			node.Keys[i+1] = node.Keys[i]
-			node.Values[i+1] = node.Values[i]
-			i--
+		i := 0
+		for i < len(node.Keys) && bt.Cmp(node.Keys[i], key) < 0 {
+			i++
 		}
+		if i < len(node.Keys) && bt.Cmp(node.Keys[i], key) == 0 {
+			node.Values[i] = append(node.Values[i], value)
+		} else {
+			node.Keys = append(node.Keys, nil)
+			copy(node.Keys[i+1:], node.Keys[i:])
+			node.Keys[i] = key
 
-		node.Keys[i+1] = key
-		node.Values[i+1] = value
-	} else {
-		for i >= 0 && compare(key, node.Keys[i]) < 0 {
-			i--
+			node.Values = append(node.Values, nil)
+			copy(node.Values[i+1:], node.Values[i:])
+			node.Values[i] = []interface{}{value}
 		}
-		i++
 
-		if len(node.Children[i].Keys) >= bt.Order {
-			bt.splitChild(node, i)
-			if compare(key, node.Keys[i]) > 0 {
-				i++
-			}
+		if len(node.Keys) <= bt.Order {
+			return nil, nil, false
 		}
+		return bt.splitLeaf(node)
+	}
+
+	i := 0
+	for i < len(node.Keys) && bt.Cmp(key, node.Keys[i]) >= 0 {
+		i++
+	}
+	childKey, childNode, childSplit := bt.insertRec(node.Children[i], key, value)
+	if !childSplit {
+		return nil, nil, false
+	}
+
+	node.Keys = append(node.Keys, nil)
+	copy(node.Keys[i+1:], node.Keys[i:])
+	node.Keys[i] = childKey
 
-		bt.insertNonFull(node.Children[i], key, value)
+	node.Children = append(node.Children, nil)
+	copy(node.Children[i+2:], node.Children[i+1:])
+	node.Children[i+1] = childNode
+
+	if len(node.Keys) <= bt.Order {
+		return nil, nil, false
 	}
+	return bt.splitInternal(node)
 }
 
-func (bt *BTreeIndex) splitChild(parent *BTreeNode, index int) {
-	fullNode := parent.Children[index]
-	newNode := NewBTreeNode(fullNode.IsLeaf)
-	mid := bt.Order / 2
+// splitLeaf moves the right half of an overflowing leaf into a new sibling,
+// linked in via Next/Prev, and promotes a copy of the new sibling's first
+// key as the separator - nothing is deleted from the leaf's data, unlike
+// the old B-Tree's splitChild, which shifted the promoted key (and, for a
+// leaf, its value) out of the leaf entirely and lost it.
+func (bt *BTreeIndex) splitLeaf(leaf *BTreeNode) (promotedKey interface{}, newLeaf *BTreeNode, split bool) {
+	mid := len(leaf.Keys) / 2
+	newLeaf = NewBTreeNode(true)
+	newLeaf.Keys = append(newLeaf.Keys, leaf.Keys[mid:]...)
+	newLeaf.Values = append(newLeaf.Values, leaf.Values[mid:]...)
+	leaf.Keys = leaf.Keys[:mid]
+	leaf.Values = leaf.Values[:mid]
+
+	newLeaf.Next = leaf.Next
+	if newLeaf.Next != nil {
+		newLeaf.Next.Prev = newLeaf
+	}
+	leaf.Next = newLeaf
+	newLeaf.Prev = leaf
 
-	// Move half of keys to new node
-	// Note: Go slices are references, but we want to cut.
-	// fullNode.Keys[mid:]
+	return newLeaf.Keys[0], newLeaf, true
+}
 
-	// Create copies to be safe or use append
-	newNode.Keys = append(newNode.Keys, fullNode.Keys[mid:]...)
-	fullNode.Keys = fullNode.Keys[:mid]
+// splitInternal moves the right half of an overflowing internal node's
+// separators and children into a new sibling, promoting the middle
+// separator - which, unlike a leaf split, the node itself does not keep a
+// copy of, since it no longer separates any of the node's own children.
+func (bt *BTreeIndex) splitInternal(node *BTreeNode) (promotedKey interface{}, newNode *BTreeNode, split bool) {
+	mid := len(node.Keys) / 2
+	promotedKey = node.Keys[mid]
 
-	if fullNode.IsLeaf {
-		newNode.Values = append(newNode.Values, fullNode.Values[mid:]...)
-		fullNode.Values = fullNode.Values[:mid]
-	} else {
-		newNode.Children = append(newNode.Children, fullNode.Children[mid:]...)
-		fullNode.Children = fullNode.Children[:mid]
-	}
-
-	// Move middle key up to parent
-	// In standard B-Tree, middle key moves up.
-	// JS implementation: "newNode.keys = fullNode.keys.splice(mid)" ... "middleKey = newNode.keys.shift()"
-	// So conceptually:
-	// [0..mid-1] stay in fullNode
-	// [mid] moves up
-	// [mid+1..end] go to newNode
-
-	// Wait, JS splice(mid) removes elements from mid to end and returns them.
-	// So fullNode keeps 0..mid-1. NewNode gets mid..end.
-	// Then shift() takes the first of newNode (which was 'mid').
-
-	// So my Go logic above:
-	// newNode.Keys gets index 'mid' onwards.
-	// Then I need to take the first element of newNode.Keys as middleKey.
-
-	middleKey := newNode.Keys[0]
-	newNode.Keys = newNode.Keys[1:]
-
-	if fullNode.IsLeaf {
-		// In JS: if leaf, values.shift().
-		// This implies the value associated with the promoted key is also removed from the leaf?
-		// "node.values.shift()"
-		// Usually in B+ Trees, leaves keep all keys. In B-Trees, keys move up.
-		// The JS implementation seems to be a B-Tree (values move with keys? or just lost for the pivot?)
-		// JS: node.values.shift(). It removes the value associated with the middle key from the leaf.
-		// So data for that key is... gone from the leaf?
-		// Wait, if it's a B-Tree, internal nodes store keys AND values (or just keys in internal?)
-		// JS BTreeNode has values only "For leaf nodes". Children for internal.
-		// If a key moves up to an internal node, where does its value go?
-		// The JS code doesn't store values in internal nodes!
-		// "this.children = [] // For internal nodes" vs "this.values = [] // For leaf nodes"
-		// If a key moves up, its value is LOST if it's not stored in internal nodes.
-		// BUT the JS code `_insertNonFull`:
-		// If leaf: store key and value.
-		// If split: Move middle key up. `values.shift()`.
-		// If internal node keys don't store values, then searching for that key in internal node won't find the value?
-		// JS `_searchNode`:
-		// `if (key === node.keys[i])`
-		// `if (node.isLeaf) return vals...`
-		// `else return _searchNode(node.children[i+1], key)`
-		// It SKIPS the match in internal node and goes to right child!
-		// This implies the key MUST exist in the right child (or left?) if it's acting as a pivot.
-		// But in `splitChild`, the key was REMOVED from the child (it was shifted from newNode).
-		// So the key is in Parent, but NOT in children.
-		// And search skips Parent match and goes to child.
-		// This logic seems flawed in the JS source or I am misreading.
-		// `if (key === node.keys[i])`:
-		//    If NOT leaf, `return this._searchNode(node.children[i + 1], key);`
-		//    The key match is found in internal node. We descend to `i+1`.
-		//    Does `children[i+1]` contain the key?
-		//    We just removed it from `newNode` (which is `children[i+1]`).
-		// So the key is NOT in `children[i+1]`.
-		// So `_searchNode` will likely NOT find it in the child?
-		// Unless I misread `splice` or something.
-		// `newNode.keys` had `mid`...`end`. `shift` removed `mid`.
-		// So `mid` is gone from newNode.
-		// So `mid` is ONLY in parent.
-		// But `_searchNode` ignores match in parent and descends.
-		// So `search` returns `[]` (not found) for keys that were promoted?
-		// This looks like a bug in the JS implementation provided.
-		// However, I must port it AS IS.
-		// If the JS version is broken for split keys, so be it?
-		// Or maybe `_searchNode` logic finds it later?
-		// Wait, if `key > node.keys[i]` -> `i++`.
-		// If `key == node.keys[i]`, we hit the block.
-		// `else` (internal): `_searchNode(node.children[i+1], key)`.
-		// It essentially says "If equal, go right".
-		// Maybe the key is duplicated?
-		// But `shift()` removes it.
-		// Okay, I will strictly follow the JS logic. "Garbage in, garbage out" or maybe there's a trick I don't see.
-		// Actually, if I look at `delete` or others, maybe it expects it.
-		// Let's just blindly port the logic.
-
-		newNode.Values = newNode.Values[1:]
-	}
-
-	// Insert into parent
-	// Insert middleKey at index
-	// Insert newNode at index+1
-
-	// Expand parent keys/children
-	parent.Keys = append(parent.Keys, nil)
-	copy(parent.Keys[index+1:], parent.Keys[index:])
-	parent.Keys[index] = middleKey
-
-	parent.Children = append(parent.Children, nil)
-	copy(parent.Children[index+2:], parent.Children[index+1:])
-	parent.Children[index+1] = newNode
+	newNode = NewBTreeNode(false)
+	newNode.Keys = append(newNode.Keys, node.Keys[mid+1:]...)
+	newNode.Children = append(newNode.Children, node.Children[mid+1:]...)
+
+	node.Keys = node.Keys[:mid]
+	node.Children = node.Children[:mid+1]
+
+	return promotedKey, newNode, true
+}
+
+// findLeaf descends to the leaf that holds key, or would hold it if absent.
+func (bt *BTreeIndex) findLeaf(key interface{}) *BTreeNode {
+	node := bt.Root
+	for !node.IsLeaf {
+		i := 0
+		for i < len(node.Keys) && bt.Cmp(key, node.Keys[i]) >= 0 {
+			i++
+		}
+		node = node.Children[i]
+	}
+	return node
 }
 
+func (bt *BTreeIndex) leftmostLeaf() *BTreeNode {
+	node := bt.Root
+	for !node.IsLeaf {
+		node = node.Children[0]
+	}
+	return node
+}
+
+func (bt *BTreeIndex) rightmostLeaf() *BTreeNode {
+	node := bt.Root
+	for !node.IsLeaf {
+		node = node.Children[len(node.Children)-1]
+	}
+	return node
+}
+
+// Search returns key's whole value bucket, or an empty slice if key isn't
+// indexed.
 func (bt *BTreeIndex) Search(key interface{}) []interface{} {
-	return bt.searchNode(bt.Root, key)
+	leaf := bt.findLeaf(key)
+	for i, k := range leaf.Keys {
+		if bt.Cmp(k, key) == 0 {
+			return leaf.Values[i]
+		}
+	}
+	return []interface{}{}
 }
 
-func (bt *BTreeIndex) searchNode(node *BTreeNode, key interface{}) []interface{} {
-	i := 0
-	for i < len(node.Keys) && compare(key, node.Keys[i]) > 0 {
-		i++
+// SampleKey returns an arbitrary indexed key - the first key of the
+// leftmost leaf - and whether the index holds any keys at all, for callers
+// that just need a representative key (e.g. to infer the indexed field's
+// type) without walking the tree themselves.
+func (bt *BTreeIndex) SampleKey() (interface{}, bool) {
+	leaf := bt.leftmostLeaf()
+	if len(leaf.Keys) == 0 {
+		return nil, false
 	}
+	return leaf.Keys[0], true
+}
 
-	if i < len(node.Keys) && compare(key, node.Keys[i]) == 0 {
-		if node.IsLeaf {
-			// In JS: return Array.isArray(val) ? val : [val]
-			// We store val as interface{}. If it's a slice, expand?
-			// The JS insert puts `data` (whole object) as value.
-			// So it's likely a single objects.
-			// However `node.values` in JS is array of references.
-			// Wait, the JS `insert` logic: `node.values[i+1] = value`.
-			// It overwrites? No, it shifts then sets. So one value per key.
-			// But BTree usually handles duplicates?
-			// JS implementation seems to overwrite/store one value per unique key instance in that sorted slot?
-			// Actually `insert` finds position. equality behavior?
-			// `while (i >= 0 && key < node.keys[i])`.
-			// If key == node.keys[i], it stops?
-			// No, `key < ...` is false. Loop stops.
-			// It inserts at `i+1`.
-			// So it inserts AFTER the equal key.
-			// So it supports duplicates.
-			// So `Search` finding the *first* match:
-			// `while ... key > node.keys[i]`. Stops at equal.
-			// Returns `node.values[i]`.
-			// This effectively returns the *first* one found in that node.
-			// What about others? Unclear. JS logic says `return Array.isArray...` implying value could be array?
-			// But `insert` puts single value.
-			// Unless `value` passed to insert IS an array?
-			// In `WowoEngine`: `index.insert(data[field], data);` -> `data` is an object.
-			// So it returns `[obj]`.
-			val := node.Values[i]
-			return []interface{}{val}
-		} else {
-			return bt.searchNode(node.Children[i+1], key)
+// Delete removes value from key's bucket, returning whether anything was
+// removed. Rebalancing is delayed: only a leaf that drops below Order/2
+// entries triggers a borrow from a sibling or, failing that, a merge -
+// everything else is left as a plain bucket (or key) removal.
+func (bt *BTreeIndex) Delete(key, value interface{}) bool {
+	leaf := bt.findLeaf(key)
+
+	ki := -1
+	for i, k := range leaf.Keys {
+		if bt.Cmp(k, key) == 0 {
+			ki = i
+			break
 		}
 	}
+	if ki < 0 {
+		return false
+	}
+
+	bucket := leaf.Values[ki]
+	vi := -1
+	for i, v := range bucket {
+		if reflect.DeepEqual(v, value) {
+			vi = i
+			break
+		}
+	}
+	if vi < 0 {
+		return false
+	}
+
+	leaf.Values[ki] = append(bucket[:vi], bucket[vi+1:]...)
+	if len(leaf.Values[ki]) == 0 {
+		leaf.Keys = append(leaf.Keys[:ki], leaf.Keys[ki+1:]...)
+		leaf.Values = append(leaf.Values[:ki], leaf.Values[ki+1:]...)
+	}
+
+	if leaf != bt.Root && len(leaf.Keys) < bt.Order/2 {
+		bt.rebalance(leaf)
+	}
+	return true
+}
+
+// rebalance restores node's minimum occupancy (Order/2 keys) after a delete
+// left it under that bound, by borrowing a key from a sibling that has one
+// to spare, or merging with one otherwise. The root is exempt - it's
+// allowed to run arbitrarily low, down to a single child, at which point it
+// is replaced by that child.
+func (bt *BTreeIndex) rebalance(node *BTreeNode) {
+	if node == bt.Root {
+		return
+	}
+	parent, idx := bt.findParent(bt.Root, node)
+	if parent == nil {
+		return
+	}
+
+	min := bt.Order / 2
+
+	if idx > 0 && len(parent.Children[idx-1].Keys) > min {
+		bt.borrowFromLeft(parent, idx, parent.Children[idx-1], node)
+		return
+	}
+	if idx < len(parent.Children)-1 && len(parent.Children[idx+1].Keys) > min {
+		bt.borrowFromRight(parent, idx, node, parent.Children[idx+1])
+		return
+	}
+
+	if idx > 0 {
+		bt.mergeChildren(parent, idx-1)
+	} else {
+		bt.mergeChildren(parent, idx)
+	}
 
+	if parent == bt.Root {
+		if !parent.IsLeaf && len(parent.Children) == 1 {
+			bt.Root = parent.Children[0]
+		}
+		return
+	}
+	if len(parent.Keys) < min {
+		bt.rebalance(parent)
+	}
+}
+
+// borrowFromLeft moves left's last entry into node (child idx of parent),
+// fixing up the separator at parent.Keys[idx-1] to match.
+func (bt *BTreeIndex) borrowFromLeft(parent *BTreeNode, idx int, left, node *BTreeNode) {
+	n := len(left.Keys) - 1
 	if node.IsLeaf {
-		return []interface{}{}
+		node.Keys = append([]interface{}{left.Keys[n]}, node.Keys...)
+		node.Values = append([][]interface{}{left.Values[n]}, node.Values...)
+		left.Keys = left.Keys[:n]
+		left.Values = left.Values[:n]
+		parent.Keys[idx-1] = node.Keys[0]
+	} else {
+		lastChild := left.Children[len(left.Children)-1]
+		node.Keys = append([]interface{}{parent.Keys[idx-1]}, node.Keys...)
+		node.Children = append([]*BTreeNode{lastChild}, node.Children...)
+		parent.Keys[idx-1] = left.Keys[n]
+		left.Keys = left.Keys[:n]
+		left.Children = left.Children[:len(left.Children)-1]
 	}
+}
 
-	return bt.searchNode(node.Children[i], key)
+// borrowFromRight moves right's first entry into node (child idx of
+// parent), fixing up the separator at parent.Keys[idx] to match.
+func (bt *BTreeIndex) borrowFromRight(parent *BTreeNode, idx int, node, right *BTreeNode) {
+	if node.IsLeaf {
+		node.Keys = append(node.Keys, right.Keys[0])
+		node.Values = append(node.Values, right.Values[0])
+		right.Keys = right.Keys[1:]
+		right.Values = right.Values[1:]
+		parent.Keys[idx] = right.Keys[0]
+	} else {
+		firstChild := right.Children[0]
+		node.Keys = append(node.Keys, parent.Keys[idx])
+		node.Children = append(node.Children, firstChild)
+		parent.Keys[idx] = right.Keys[0]
+		right.Keys = right.Keys[1:]
+		right.Children = right.Children[1:]
+	}
 }
 
+// mergeChildren folds parent's child at leftIdx+1 into the one at leftIdx
+// and drops the separator between them - pulled down into the merged node
+// for an internal merge, simply discarded for a leaf merge, which carries
+// no separator of its own.
+func (bt *BTreeIndex) mergeChildren(parent *BTreeNode, leftIdx int) {
+	left := parent.Children[leftIdx]
+	right := parent.Children[leftIdx+1]
+
+	if left.IsLeaf {
+		left.Keys = append(left.Keys, right.Keys...)
+		left.Values = append(left.Values, right.Values...)
+		left.Next = right.Next
+		if right.Next != nil {
+			right.Next.Prev = left
+		}
+	} else {
+		left.Keys = append(left.Keys, parent.Keys[leftIdx])
+		left.Keys = append(left.Keys, right.Keys...)
+		left.Children = append(left.Children, right.Children...)
+	}
+
+	parent.Keys = append(parent.Keys[:leftIdx], parent.Keys[leftIdx+1:]...)
+	parent.Children = append(parent.Children[:leftIdx+1], parent.Children[leftIdx+2:]...)
+}
+
+// findParent returns the direct parent of node within root's subtree, plus
+// node's index among its parent's children - or (nil, -1) if root is node
+// or a leaf. node's first key (or, for an empty internal node, its
+// leftmost child's subtree) guides the descent.
+func (bt *BTreeIndex) findParent(root, node *BTreeNode) (*BTreeNode, int) {
+	if root.IsLeaf {
+		return nil, -1
+	}
+	for i, child := range root.Children {
+		if child == node {
+			return root, i
+		}
+	}
+
+	i := 0
+	if len(node.Keys) > 0 {
+		probe := node.Keys[0]
+		for i < len(root.Keys) && bt.Cmp(probe, root.Keys[i]) >= 0 {
+			i++
+		}
+	}
+	return bt.findParent(root.Children[i], node)
+}
+
+// Range returns every value whose key falls in [min, max], found by
+// descending once to the leaf containing min and then walking the Next
+// links until a key exceeds max - O(log n + k) instead of the old
+// recursive full-subtree walk.
 func (bt *BTreeIndex) Range(min, max interface{}) []interface{} {
 	results := make([]interface{}, 0)
-	bt.rangeSearch(bt.Root, min, max, &results)
+	leaf := bt.findLeaf(min)
+	for leaf != nil {
+		for i, k := range leaf.Keys {
+			if bt.Cmp(k, min) < 0 {
+				continue
+			}
+			if bt.Cmp(k, max) > 0 {
+				return results
+			}
+			results = append(results, leaf.Values[i]...)
+		}
+		leaf = leaf.Next
+	}
 	return results
 }
 
-func (bt *BTreeIndex) rangeSearch(node *BTreeNode, min, max interface{}, results *[]interface{}) {
+// Cursor enumerates an index's leaves in key order (or reverse, via Prev),
+// one (key, value) pair at a time - including every value in a duplicate
+// key's bucket before moving to the next key - matching the cznic/lldb
+// enumerator convention of signalling exhaustion with io.EOF rather than a
+// boolean.
+type Cursor struct {
+	leaf *BTreeNode
+	ki   int
+	vi   int
+}
+
+// SeekFirst returns a Cursor positioned at the smallest key, or io.EOF if
+// the index is empty.
+func (bt *BTreeIndex) SeekFirst() (*Cursor, error) {
+	leaf := bt.leftmostLeaf()
+	if len(leaf.Keys) == 0 {
+		return nil, io.EOF
+	}
+	return &Cursor{leaf: leaf, ki: 0, vi: 0}, nil
+}
+
+// SeekLast returns a Cursor positioned at the largest key's last value, or
+// io.EOF if the index is empty.
+func (bt *BTreeIndex) SeekLast() (*Cursor, error) {
+	leaf := bt.rightmostLeaf()
+	if len(leaf.Keys) == 0 {
+		return nil, io.EOF
+	}
+	last := len(leaf.Keys) - 1
+	return &Cursor{leaf: leaf, ki: last, vi: len(leaf.Values[last]) - 1}, nil
+}
+
+// Seek returns a Cursor positioned at the first key >= key, or io.EOF if no
+// such key exists.
+func (bt *BTreeIndex) Seek(key interface{}) (*Cursor, error) {
+	leaf := bt.findLeaf(key)
 	i := 0
-	for i < len(node.Keys) {
-		if node.IsLeaf {
-			k := node.Keys[i]
-			cMin := compare(k, min)
-			cMax := compare(k, max)
-			if cMin >= 0 && cMax <= 0 {
-				val := node.Values[i]
-				// Append val
-				*results = append(*results, val)
-			}
-			i++
-		} else {
-			k := node.Keys[i]
-			if compare(k, min) > 0 {
-				bt.rangeSearch(node.Children[i], min, max, results)
-			}
-			i++
+	for i < len(leaf.Keys) && bt.Cmp(leaf.Keys[i], key) < 0 {
+		i++
+	}
+	for i == len(leaf.Keys) && leaf.Next != nil {
+		leaf = leaf.Next
+		i = 0
+	}
+	if i == len(leaf.Keys) {
+		return nil, io.EOF
+	}
+	return &Cursor{leaf: leaf, ki: i, vi: 0}, nil
+}
+
+// Next returns the cursor's current (key, value) pair and advances past it,
+// or io.EOF once the last value has already been returned.
+func (c *Cursor) Next() (key, value interface{}, err error) {
+	if c.leaf == nil || c.ki >= len(c.leaf.Keys) {
+		return nil, nil, io.EOF
+	}
+	key = c.leaf.Keys[c.ki]
+	value = c.leaf.Values[c.ki][c.vi]
+
+	c.vi++
+	if c.vi >= len(c.leaf.Values[c.ki]) {
+		c.vi = 0
+		c.ki++
+		if c.ki >= len(c.leaf.Keys) {
+			c.leaf = c.leaf.Next
+			c.ki = 0
 		}
 	}
+	return key, value, nil
+}
 
-	if !node.IsLeaf && len(node.Children) > i {
-		bt.rangeSearch(node.Children[i], min, max, results)
+// Prev returns the cursor's current (key, value) pair and steps back past
+// it, or io.EOF once the first value has already been returned.
+func (c *Cursor) Prev() (key, value interface{}, err error) {
+	if c.leaf == nil || c.ki < 0 || c.ki >= len(c.leaf.Keys) {
+		return nil, nil, io.EOF
 	}
+	key = c.leaf.Keys[c.ki]
+	value = c.leaf.Values[c.ki][c.vi]
+
+	c.vi--
+	if c.vi < 0 {
+		c.ki--
+		if c.ki < 0 {
+			c.leaf = c.leaf.Prev
+			if c.leaf != nil {
+				c.ki = len(c.leaf.Keys) - 1
+			}
+		}
+		if c.leaf != nil && c.ki >= 0 {
+			c.vi = len(c.leaf.Values[c.ki]) - 1
+		}
+	}
+	return key, value, nil
 }
 
 func (bt *BTreeIndex) Stats() map[string]interface{} {
@@ -350,13 +701,15 @@ func (bt *BTreeIndex) Stats() map[string]interface{} {
 	var traverse func(*BTreeNode, int)
 	traverse = func(node *BTreeNode, depth int) {
 		nodeCount++
-		keyCount += len(node.Keys)
 		if depth > maxDepth {
 			maxDepth = depth
 		}
 
 		if node.IsLeaf {
 			leafCount++
+			for _, bucket := range node.Values {
+				keyCount += len(bucket)
+			}
 		} else {
 			for _, child := range node.Children {
 				traverse(child, depth+1)
@@ -0,0 +1,132 @@
+package index
+
+import (
+	"io"
+	"testing"
+)
+
+// TestBTreeIndexSplitPromotionKeepsAllValues guards against the original
+// split-promotion bug: every inserted key must remain searchable - including
+// one whose key happened to get promoted into an internal node as a
+// separator - since a real B+Tree keeps keys (and their values) in the
+// leaves only, never deleting them on promotion.
+func TestBTreeIndexSplitPromotionKeepsAllValues(t *testing.T) {
+	bt := NewBTreeIndex(4) // small order forces splits well within this test's range
+	const n = 200
+	for i := 0; i < n; i++ {
+		bt.Insert(i, i*10)
+	}
+
+	for i := 0; i < n; i++ {
+		vals := bt.Search(i)
+		if len(vals) != 1 || vals[0] != i*10 {
+			t.Fatalf("key %d: expected [%d], got %v", i, i*10, vals)
+		}
+	}
+}
+
+func TestBTreeIndexDuplicateKeysBucket(t *testing.T) {
+	bt := NewBTreeIndex(4)
+	bt.Insert("a", 1)
+	bt.Insert("a", 2)
+	bt.Insert("a", 3)
+
+	vals := bt.Search("a")
+	if len(vals) != 3 {
+		t.Fatalf("expected 3 values in the bucket for a duplicate key, got %v", vals)
+	}
+}
+
+// TestBTreeIndexRangeAcrossSiblingLinks verifies Range descends once to the
+// leaf containing min and then walks forward via Next, rather than
+// recursing the whole tree, by checking it returns exactly the keys in
+// [min, max] after enough inserts to force multiple leaf splits.
+func TestBTreeIndexRangeAcrossSiblingLinks(t *testing.T) {
+	bt := NewBTreeIndex(4)
+	const n = 100
+	for i := 0; i < n; i++ {
+		bt.Insert(i, i)
+	}
+
+	got := bt.Range(10, 20)
+	if len(got) != 11 {
+		t.Fatalf("expected 11 keys in [10,20], got %d: %v", len(got), got)
+	}
+	seen := make(map[int]bool, len(got))
+	for _, v := range got {
+		seen[v.(int)] = true
+	}
+	for i := 10; i <= 20; i++ {
+		if !seen[i] {
+			t.Errorf("Range(10,20) missing key %d", i)
+		}
+	}
+}
+
+func TestBTreeIndexCursorForwardAndBackward(t *testing.T) {
+	bt := NewBTreeIndex(4)
+	for i := 0; i < 50; i++ {
+		bt.Insert(i, i)
+	}
+
+	cur, err := bt.SeekFirst()
+	if err != nil {
+		t.Fatalf("SeekFirst: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		k, v, err := cur.Next()
+		if err != nil {
+			t.Fatalf("Next at %d: %v", i, err)
+		}
+		if k != i || v != i {
+			t.Fatalf("expected (%d,%d), got (%v,%v)", i, i, k, v)
+		}
+	}
+	if _, _, err := cur.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after exhausting cursor, got %v", err)
+	}
+
+	cur, err = bt.SeekLast()
+	if err != nil {
+		t.Fatalf("SeekLast: %v", err)
+	}
+	for i := 49; i >= 0; i-- {
+		k, v, err := cur.Prev()
+		if err != nil {
+			t.Fatalf("Prev at %d: %v", i, err)
+		}
+		if k != i || v != i {
+			t.Fatalf("expected (%d,%d), got (%v,%v)", i, i, k, v)
+		}
+	}
+}
+
+func TestBTreeIndexDeleteRebalances(t *testing.T) {
+	bt := NewBTreeIndex(4)
+	const n = 60
+	for i := 0; i < n; i++ {
+		bt.Insert(i, i)
+	}
+
+	for i := 0; i < n; i += 2 {
+		if !bt.Delete(i, i) {
+			t.Fatalf("Delete(%d): expected to find and remove the key", i)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		vals := bt.Search(i)
+		if i%2 == 0 {
+			if len(vals) != 0 {
+				t.Errorf("key %d: expected deleted, still found %v", i, vals)
+			}
+		} else if len(vals) != 1 || vals[0] != i {
+			t.Errorf("key %d: expected [%d], got %v", i, i, vals)
+		}
+	}
+
+	got := bt.Range(0, n-1)
+	if len(got) != n/2 {
+		t.Fatalf("expected %d surviving keys after deletes, got %d", n/2, len(got))
+	}
+}
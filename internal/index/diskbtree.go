@@ -0,0 +1,658 @@
+package index
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/WowoEngine/SawitDB-Go/internal/storage"
+)
+
+// DiskBTree is a B+Tree whose nodes live in pages allocated through a
+// storage.Pager instead of the Go heap, so a table catalog can persist
+// Root() in page 0 and reopen the index with OpenDiskBTree instead of
+// re-scanning every record on startup, the way the in-memory BTreeIndex's
+// callers (indexdir.go) have to. Unlike BTreeIndex, whose bucket values can
+// be any Go value (normally the whole row), a DiskBTree's key and value are
+// both plain []byte - arbitrary Go values don't have a byte representation
+// to page out, so callers are expected to pass already-encoded keys (e.g.
+// via index.Encode) and a value of their own choosing, such as a pointer to
+// the row's table page and offset.
+type DiskBTree struct {
+	pager *storage.Pager
+	root  uint32
+	cache *nodeCache
+}
+
+// errPageFull is insertRec's signal that a node, after gaining a key, no
+// longer fits in one page - the cue to split it, same as the in-memory
+// BTreeIndex splitting once it holds more than Order keys.
+var errPageFull = errors.New("index: node no longer fits in one page")
+
+// NewDiskBTree allocates a fresh root leaf page through pager and returns a
+// DiskBTree rooted there, caching up to cacheSize decoded nodes.
+func NewDiskBTree(pager *storage.Pager, cacheSize int) (*DiskBTree, error) {
+	bt := &DiskBTree{pager: pager, cache: newNodeCache(cacheSize)}
+	root, err := bt.allocNode(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := bt.putNode(root); err != nil {
+		return nil, err
+	}
+	bt.root = root.pageID
+	return bt, nil
+}
+
+// OpenDiskBTree reattaches to a tree whose root page id was previously read
+// back from wherever the caller persisted DiskBTree.Root() - page 0's index
+// directory, for instance.
+func OpenDiskBTree(pager *storage.Pager, root uint32, cacheSize int) *DiskBTree {
+	return &DiskBTree{pager: pager, root: root, cache: newNodeCache(cacheSize)}
+}
+
+// Root returns the tree's current root page id, which moves every time
+// Insert splits the root - callers must re-persist it after any write that
+// might have done so.
+func (bt *DiskBTree) Root() uint32 {
+	return bt.root
+}
+
+// Insert adds key/value to the tree, overwriting any existing value already
+// stored under an equal key - one value per key, unlike BTreeIndex's
+// duplicate-friendly bucket.
+func (bt *DiskBTree) Insert(key, value []byte) error {
+	root, err := bt.getNode(bt.root)
+	if err != nil {
+		return err
+	}
+	promoted, newChildID, split, err := bt.insertRec(root, key, value)
+	if err != nil {
+		return err
+	}
+	if split {
+		newRoot, err := bt.allocNode(false)
+		if err != nil {
+			return err
+		}
+		newRoot.keys = [][]byte{promoted}
+		newRoot.children = []uint32{root.pageID, newChildID}
+		if err := bt.putNode(newRoot); err != nil {
+			return err
+		}
+		bt.root = newRoot.pageID
+	}
+	return bt.pager.Flush()
+}
+
+func (bt *DiskBTree) insertRec(node *diskNode, key, value []byte) (promoted []byte, newChildID uint32, split bool, err error) {
+	if node.isLeaf {
+		i := 0
+		for i < len(node.keys) && bytes.Compare(node.keys[i], key) < 0 {
+			i++
+		}
+		if i < len(node.keys) && bytes.Equal(node.keys[i], key) {
+			node.values[i] = value
+		} else {
+			node.keys = insertBytes(node.keys, i, key)
+			node.values = insertBytes(node.values, i, value)
+		}
+
+		if err := bt.putNode(node); err == nil {
+			return nil, 0, false, nil
+		} else if err != errPageFull {
+			return nil, 0, false, err
+		}
+		return bt.splitLeaf(node)
+	}
+
+	i := 0
+	for i < len(node.keys) && bytes.Compare(key, node.keys[i]) >= 0 {
+		i++
+	}
+	child, err := bt.getNode(node.children[i])
+	if err != nil {
+		return nil, 0, false, err
+	}
+	childPromoted, childNewID, childSplit, err := bt.insertRec(child, key, value)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !childSplit {
+		return nil, 0, false, nil
+	}
+
+	node.keys = insertBytes(node.keys, i, childPromoted)
+	node.children = insertUint32(node.children, i+1, childNewID)
+
+	if err := bt.putNode(node); err == nil {
+		return nil, 0, false, nil
+	} else if err != errPageFull {
+		return nil, 0, false, err
+	}
+	return bt.splitInternal(node)
+}
+
+// splitLeaf moves the right half of an overflowing leaf into a new sibling
+// page, linking it into the leaf chain on both sides, and promotes a copy
+// of its first key - the same shape as BTreeIndex.splitLeaf, just with page
+// ids standing in for Go pointers.
+func (bt *DiskBTree) splitLeaf(leaf *diskNode) (promoted []byte, newChildID uint32, split bool, err error) {
+	mid := len(leaf.keys) / 2
+	newLeaf, err := bt.allocNode(true)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	newLeaf.keys = append([][]byte(nil), leaf.keys[mid:]...)
+	newLeaf.values = append([][]byte(nil), leaf.values[mid:]...)
+	newLeaf.next = leaf.next
+	newLeaf.prev = leaf.pageID
+
+	leaf.keys = leaf.keys[:mid]
+	leaf.values = leaf.values[:mid]
+	leaf.next = newLeaf.pageID
+
+	if newLeaf.next != 0 {
+		following, err := bt.getNode(newLeaf.next)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		following.prev = newLeaf.pageID
+		if err := bt.putNode(following); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	if err := bt.putNode(newLeaf); err != nil {
+		return nil, 0, false, err
+	}
+	if err := bt.putNode(leaf); err != nil {
+		return nil, 0, false, err
+	}
+	return newLeaf.keys[0], newLeaf.pageID, true, nil
+}
+
+// splitInternal moves the right half of an overflowing internal node's
+// separators and children into a new sibling page, promoting the middle
+// separator - the node keeps no copy of it, since it no longer separates
+// any of the node's own children.
+func (bt *DiskBTree) splitInternal(node *diskNode) (promoted []byte, newChildID uint32, split bool, err error) {
+	mid := len(node.keys) / 2
+	promotedKey := node.keys[mid]
+
+	newNode, err := bt.allocNode(false)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	newNode.keys = append([][]byte(nil), node.keys[mid+1:]...)
+	newNode.children = append([]uint32(nil), node.children[mid+1:]...)
+
+	node.keys = node.keys[:mid]
+	node.children = node.children[:mid+1]
+
+	if err := bt.putNode(newNode); err != nil {
+		return nil, 0, false, err
+	}
+	if err := bt.putNode(node); err != nil {
+		return nil, 0, false, err
+	}
+	return promotedKey, newNode.pageID, true, nil
+}
+
+// Search returns key's value, or found=false if key isn't indexed.
+func (bt *DiskBTree) Search(key []byte) (value []byte, found bool, err error) {
+	node, err := bt.findLeaf(key)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, k := range node.keys {
+		if bytes.Equal(k, key) {
+			return node.values[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// KV is one key/value pair, returned by Range and DiskCursor.
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+// Range returns every entry with a key in [min, max] (max == nil means no
+// upper bound), walking leaf sibling links from min's leaf so the cost is
+// O(log n + k) instead of a full scan, the same guarantee BTreeIndex.Range
+// makes.
+func (bt *DiskBTree) Range(min, max []byte) ([]KV, error) {
+	node, err := bt.findLeaf(min)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []KV
+	for node != nil {
+		for i, k := range node.keys {
+			if bytes.Compare(k, min) < 0 {
+				continue
+			}
+			if max != nil && bytes.Compare(k, max) > 0 {
+				return out, nil
+			}
+			out = append(out, KV{Key: k, Value: node.values[i]})
+		}
+		if node.next == 0 {
+			break
+		}
+		node, err = bt.getNode(node.next)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Delete removes key, returning whether it was present. Unlike
+// BTreeIndex.Delete, it doesn't rebalance an underfull node afterward -
+// borrowing from or merging with a sibling page means walking back up the
+// tree, which needs parent links this format doesn't keep (findLeaf only
+// descends). An underfull leaf left behind is harmless, just a little less
+// space-efficient than a freshly built tree; reclaiming that space is a
+// bigger change better left to a follow-up.
+func (bt *DiskBTree) Delete(key []byte) (bool, error) {
+	node, err := bt.findLeaf(key)
+	if err != nil {
+		return false, err
+	}
+	for i, k := range node.keys {
+		if !bytes.Equal(k, key) {
+			continue
+		}
+		node.keys = append(node.keys[:i], node.keys[i+1:]...)
+		node.values = append(node.values[:i], node.values[i+1:]...)
+		if err := bt.putNode(node); err != nil {
+			return false, err
+		}
+		return true, bt.pager.Flush()
+	}
+	return false, nil
+}
+
+func (bt *DiskBTree) findLeaf(key []byte) (*diskNode, error) {
+	node, err := bt.getNode(bt.root)
+	if err != nil {
+		return nil, err
+	}
+	for !node.isLeaf {
+		i := 0
+		for i < len(node.keys) && bytes.Compare(key, node.keys[i]) >= 0 {
+			i++
+		}
+		node, err = bt.getNode(node.children[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (bt *DiskBTree) leftmostLeaf() (*diskNode, error) {
+	node, err := bt.getNode(bt.root)
+	if err != nil {
+		return nil, err
+	}
+	for !node.isLeaf {
+		node, err = bt.getNode(node.children[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (bt *DiskBTree) rightmostLeaf() (*diskNode, error) {
+	node, err := bt.getNode(bt.root)
+	if err != nil {
+		return nil, err
+	}
+	for !node.isLeaf {
+		node, err = bt.getNode(node.children[len(node.children)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (bt *DiskBTree) getNode(pageID uint32) (*diskNode, error) {
+	if n, ok := bt.cache.get(pageID); ok {
+		return n, nil
+	}
+	buf, err := bt.pager.ReadPage(pageID)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeDiskNode(pageID, buf)
+	if err != nil {
+		return nil, err
+	}
+	bt.cache.put(pageID, n)
+	return n, nil
+}
+
+func (bt *DiskBTree) putNode(n *diskNode) error {
+	buf, err := n.encode()
+	if err != nil {
+		return err
+	}
+	if err := bt.pager.WritePageNoSync(n.pageID, buf); err != nil {
+		return err
+	}
+	bt.cache.put(n.pageID, n)
+	return nil
+}
+
+func (bt *DiskBTree) allocNode(isLeaf bool) (*diskNode, error) {
+	pageID, err := bt.pager.AllocPage()
+	if err != nil {
+		return nil, err
+	}
+	return &diskNode{pageID: pageID, isLeaf: isLeaf}, nil
+}
+
+func insertBytes(s [][]byte, i int, v []byte) [][]byte {
+	s = append(s, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func insertUint32(s []uint32, i int, v uint32) []uint32 {
+	s = append(s, 0)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+// DiskCursor enumerates a DiskBTree's entries in key order, following leaf
+// sibling links both ways so a full forward or backward scan never revisits
+// an internal node - the same shape as BTreeIndex's in-memory Cursor.
+type DiskCursor struct {
+	bt   *DiskBTree
+	node *diskNode
+	pos  int
+	done bool
+}
+
+// Cursor returns a new, unpositioned Cursor over bt - call SeekFirst,
+// SeekLast or Seek before Next/Prev.
+func (bt *DiskBTree) Cursor() *DiskCursor {
+	return &DiskCursor{bt: bt}
+}
+
+// SeekFirst positions the cursor at the smallest key in the tree.
+func (c *DiskCursor) SeekFirst() (key, value []byte, err error) {
+	node, err := c.bt.leftmostLeaf()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.node, c.pos, c.done = node, 0, false
+	return c.advanceForward()
+}
+
+// SeekLast positions the cursor at the largest key in the tree.
+func (c *DiskCursor) SeekLast() (key, value []byte, err error) {
+	node, err := c.bt.rightmostLeaf()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.node, c.pos, c.done = node, len(node.keys)-1, false
+	return c.advanceBackward()
+}
+
+// Seek positions the cursor at the smallest key >= key.
+func (c *DiskCursor) Seek(key []byte) (k, v []byte, err error) {
+	node, err := c.bt.findLeaf(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := 0
+	for i < len(node.keys) && bytes.Compare(node.keys[i], key) < 0 {
+		i++
+	}
+	c.node, c.pos, c.done = node, i, false
+	return c.advanceForward()
+}
+
+// Next advances the cursor and returns the entry it lands on, or io.EOF
+// once the tree is exhausted.
+func (c *DiskCursor) Next() (key, value []byte, err error) {
+	c.pos++
+	return c.advanceForward()
+}
+
+// Prev moves the cursor backward and returns the entry it lands on, or
+// io.EOF once the start of the tree is reached.
+func (c *DiskCursor) Prev() (key, value []byte, err error) {
+	c.pos--
+	return c.advanceBackward()
+}
+
+func (c *DiskCursor) advanceForward() (key, value []byte, err error) {
+	if c.done {
+		return nil, nil, io.EOF
+	}
+	for c.node != nil && c.pos >= len(c.node.keys) {
+		if c.node.next == 0 {
+			c.done = true
+			return nil, nil, io.EOF
+		}
+		next, err := c.bt.getNode(c.node.next)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.node, c.pos = next, 0
+	}
+	return c.node.keys[c.pos], c.node.values[c.pos], nil
+}
+
+func (c *DiskCursor) advanceBackward() (key, value []byte, err error) {
+	if c.done {
+		return nil, nil, io.EOF
+	}
+	for c.node != nil && c.pos < 0 {
+		if c.node.prev == 0 {
+			c.done = true
+			return nil, nil, io.EOF
+		}
+		prev, err := c.bt.getNode(c.node.prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.node, c.pos = prev, len(prev.keys)-1
+	}
+	return c.node.keys[c.pos], c.node.values[c.pos], nil
+}
+
+// diskNode is the decoded in-memory form of one DiskBTree page. Leaves use
+// values and next/prev; internal nodes use children (len(children) ==
+// len(keys)+1, with children[0] stored in the same header slot a leaf uses
+// for prev, since a node is never both).
+type diskNode struct {
+	pageID   uint32
+	isLeaf   bool
+	keys     [][]byte
+	values   [][]byte // leaf only, parallel to keys
+	children []uint32 // internal only, len(children) == len(keys)+1
+	next     uint32   // leaf only: next sibling page id, 0 = none
+	prev     uint32   // leaf only: previous sibling page id, 0 = none
+}
+
+// Disk page layout for one DiskBTree node:
+//
+//	[0]      magic byte (diskNodeMagic)
+//	[1]      node type: diskLeafType or diskInternalType
+//	[2:4]    key count, uint16
+//	[4:6]    data-area start offset, uint16 (informational; encode rewrites it, decode ignores it)
+//	[6:10]   leaf only: next sibling page id, uint32 (0 if none)
+//	[10:14]  leaf only: prev sibling page id, uint32 (0 if none)
+//	         internal only: leftmost child page id, uint32
+//	[14:...] slot directory: count uint16 offsets, one per key, in key order
+//	...      record area, growing down from the end of the page; record i
+//	         lives at the offset slot i holds:
+//	           leaf:     keyLen(uint16) key valueLen(uint16) value
+//	           internal: keyLen(uint16) key child(uint32) (the child right of key)
+const (
+	diskNodeMagic     = 0xDB
+	diskNodeHeaderLen = 14
+	diskLeafType      = 0
+	diskInternalType  = 1
+)
+
+func decodeDiskNode(pageID uint32, buf []byte) (*diskNode, error) {
+	if buf[0] != diskNodeMagic {
+		return nil, fmt.Errorf("index: page %d is not a DiskBTree node", pageID)
+	}
+	isLeaf := buf[1] == diskLeafType
+	count := int(binary.LittleEndian.Uint16(buf[2:4]))
+	extra := binary.LittleEndian.Uint32(buf[10:14])
+
+	n := &diskNode{pageID: pageID, isLeaf: isLeaf}
+	if isLeaf {
+		n.next = binary.LittleEndian.Uint32(buf[6:10])
+		n.prev = extra
+	} else {
+		n.children = append(n.children, extra)
+	}
+
+	for i := 0; i < count; i++ {
+		slotOff := diskNodeHeaderLen + i*2
+		recOff := int(binary.LittleEndian.Uint16(buf[slotOff : slotOff+2]))
+		keyLen := int(binary.LittleEndian.Uint16(buf[recOff : recOff+2]))
+		key := append([]byte(nil), buf[recOff+2:recOff+2+keyLen]...)
+		n.keys = append(n.keys, key)
+
+		if isLeaf {
+			valOff := recOff + 2 + keyLen
+			valLen := int(binary.LittleEndian.Uint16(buf[valOff : valOff+2]))
+			val := append([]byte(nil), buf[valOff+2:valOff+2+valLen]...)
+			n.values = append(n.values, val)
+		} else {
+			childOff := recOff + 2 + keyLen
+			n.children = append(n.children, binary.LittleEndian.Uint32(buf[childOff:childOff+4]))
+		}
+	}
+	return n, nil
+}
+
+// encode packs n into a fresh PAGE_SIZE buffer: the slot directory grows
+// down from the header while records are appended up from the end of the
+// page, the classic slotted-page shape that lets a node's keys stay in
+// sorted order (via the slot directory) without physically shuffling
+// records whose size varies. Returns errPageFull once n no longer fits.
+func (n *diskNode) encode() ([]byte, error) {
+	buf := make([]byte, storage.PAGE_SIZE)
+	buf[0] = diskNodeMagic
+	if n.isLeaf {
+		buf[1] = diskLeafType
+		binary.LittleEndian.PutUint32(buf[6:10], n.next)
+		binary.LittleEndian.PutUint32(buf[10:14], n.prev)
+	} else {
+		buf[1] = diskInternalType
+		leftChild := uint32(0)
+		if len(n.children) > 0 {
+			leftChild = n.children[0]
+		}
+		binary.LittleEndian.PutUint32(buf[10:14], leftChild)
+	}
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(len(n.keys)))
+
+	slotBase := diskNodeHeaderLen
+	dataEnd := storage.UsablePageSize
+	for i, key := range n.keys {
+		var recLen int
+		if n.isLeaf {
+			recLen = 2 + len(key) + 2 + len(n.values[i])
+		} else {
+			recLen = 2 + len(key) + 4
+		}
+		dataEnd -= recLen
+		slotOff := slotBase + i*2
+		if dataEnd < slotOff+2 {
+			return nil, errPageFull
+		}
+		binary.LittleEndian.PutUint16(buf[slotOff:slotOff+2], uint16(dataEnd))
+
+		o := dataEnd
+		binary.LittleEndian.PutUint16(buf[o:o+2], uint16(len(key)))
+		o += 2
+		copy(buf[o:], key)
+		o += len(key)
+		if n.isLeaf {
+			binary.LittleEndian.PutUint16(buf[o:o+2], uint16(len(n.values[i])))
+			o += 2
+			copy(buf[o:], n.values[i])
+		} else {
+			binary.LittleEndian.PutUint32(buf[o:o+4], n.children[i+1])
+		}
+	}
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(dataEnd))
+	return buf, nil
+}
+
+// nodeCache holds decoded DiskBTree nodes, evicting the least recently used
+// once it grows past capacity - the same container/list LRU shape as
+// storage.pageCache and engine.planCache, kept local to this package so
+// DiskBTree doesn't need to reach into storage's private cache type.
+type nodeCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[uint32]*list.Element
+}
+
+type nodeCacheEntry struct {
+	pageID uint32
+	node   *diskNode
+}
+
+func newNodeCache(capacity int) *nodeCache {
+	return &nodeCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[uint32]*list.Element),
+	}
+}
+
+func (c *nodeCache) get(pageID uint32) (*diskNode, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[pageID]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*nodeCacheEntry).node, true
+}
+
+func (c *nodeCache) put(pageID uint32, n *diskNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[pageID]; ok {
+		el.Value.(*nodeCacheEntry).node = n
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&nodeCacheEntry{pageID: pageID, node: n})
+	c.entries[pageID] = el
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nodeCacheEntry).pageID)
+	}
+}
@@ -0,0 +1,163 @@
+// Package log is a small, stdlib-only stand-in for a structured logging
+// library (zap/zerolog/logrus and friends): a level floor honoring
+// Config.LogLevel, a human or JSON renderer, and fields a line can carry
+// without every call site building its own map. Pulling in a real one
+// would be this project's first third-party dependency; a few dozen
+// lines cover everything SawitServer actually needs from one.
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is a logger's severity, ordered so a Logger only emits a line
+// whose Level is at or above its own configured floor.
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+// ParseLevel maps a Config.LogLevel string to a Level. An unrecognized
+// string falls back to LevelInfo - unlike auth.ParseRole, a logging typo
+// should still produce output at a sane default, not go silent.
+func ParseLevel(s string) Level {
+	switch strings.ToLower(s) {
+	case "trace":
+		return LevelTrace
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// Field is one structured key/value pair attached to a log line. Use the
+// constructors below (Str, Int64, Any, ...) rather than building one
+// directly.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func Str(key, value string) Field             { return Field{key, value} }
+func Int(key string, value int) Field         { return Field{key, value} }
+func Int64(key string, value int64) Field     { return Field{key, value} }
+func Any(key string, value interface{}) Field { return Field{key, value} }
+
+// Err renders a nil error as a field whose value is nil, not the string
+// "<nil>", so a JSON consumer can tell "no error" from "an error named nil".
+func Err(err error) Field {
+	if err == nil {
+		return Field{"error", nil}
+	}
+	return Field{"error", err.Error()}
+}
+
+// Logger writes leveled, structured lines to out - either one human-
+// readable line per call, or one JSON object per call. A Logger built
+// with With carries a fixed set of fields (e.g. client_id) on every line
+// it emits from then on, so call sites don't have to repeat them.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	json   bool
+	fields []Field
+}
+
+// New builds a Logger at levelStr's level (see ParseLevel) writing to
+// os.Stdout. jsonOutput selects one-JSON-object-per-line output over the
+// human-readable default.
+func New(levelStr string, jsonOutput bool) *Logger {
+	return &Logger{out: os.Stdout, level: ParseLevel(levelStr), json: jsonOutput}
+}
+
+// With returns a child Logger that prefixes every line it emits with
+// fields in addition to whatever its parent already carries - e.g. a
+// per-connection logger that always carries client_id without every call
+// site threading it through by hand.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{out: l.out, level: l.level, json: l.json, fields: append(append([]Field{}, l.fields...), fields...)}
+}
+
+func (l *Logger) emit(level Level, msg string, fields []Field) {
+	if level < l.level {
+		return
+	}
+	all := append(append([]Field{}, l.fields...), fields...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		l.writeJSON(level, msg, all)
+	} else {
+		l.writeHuman(level, msg, all)
+	}
+}
+
+func (l *Logger) writeHuman(level Level, msg string, fields []Field) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] [%s] %s", time.Now().Format(time.RFC3339), level.String(), msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	fmt.Fprintln(l.out, b.String())
+}
+
+func (l *Logger) writeJSON(level Level, msg string, fields []Field) {
+	entry := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339),
+		"level": level.String(),
+		"msg":   msg,
+	}
+	for _, f := range fields {
+		entry[f.Key] = f.Value
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.out.Write(append(data, '\n'))
+}
+
+func (l *Logger) Trace(msg string, fields ...Field) { l.emit(LevelTrace, msg, fields) }
+func (l *Logger) Debug(msg string, fields ...Field) { l.emit(LevelDebug, msg, fields) }
+func (l *Logger) Info(msg string, fields ...Field)  { l.emit(LevelInfo, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...Field)  { l.emit(LevelWarn, msg, fields) }
+func (l *Logger) Error(msg string, fields ...Field) { l.emit(LevelError, msg, fields) }
+
+// Fatal logs at Error level and then terminates the process with exit
+// status 1, for a startup failure the caller has no way to recover from.
+func (l *Logger) Fatal(msg string, fields ...Field) {
+	l.emit(LevelError, msg, fields)
+	os.Exit(1)
+}
@@ -18,7 +18,8 @@ func NewQueryParser() *QueryParser {
 type Command struct {
 	Type     string
 	Table    string
-	Data     map[string]interface{}
+	Data     map[string]interface{}   // Convenience shim, populated only when Rows has exactly one tuple
+	Rows     []map[string]interface{} // One entry per tuple for multi-row TANAM/INSERT
 	Criteria *Criteria
 	Sort     *Sort
 	Limit    *int
@@ -26,9 +27,31 @@ type Command struct {
 	Cols     []string
 	Func     string
 	Field    string
+	KeyType  string // CREATE_INDEX: optional TIPE/TYPE clause, e.g. "BYTES"; "" means the index's default key comparator
 	Updates  map[string]interface{}
-	GroupBy  string
-	Message  string // For ERROR
+	GroupBy  []string
+	Having   *Criteria // Post-group filter for HITUNG ... KELOMPOK ... PUNYA/HAVING
+	Distinct bool      // COUNT DISTINCT field
+	Joins    []JoinSpec
+	FromLSN  interface{} // LANGGAN/SUBSCRIBE ... MULAI DARI/FROM n - a float64 literal or ParamRef, nil if the clause was omitted
+
+	// GROUP_CONCAT(field [ORDER BY k dir] [SEPARATOR ','])
+	ConcatOrderKey  string
+	ConcatOrderDir  string
+	ConcatSeparator string
+
+	Message string // For ERROR
+}
+
+// ParamRef is a placeholder left in a parsed Command's Data/Rows/Updates and
+// Criteria values wherever the source SQL had a `@name` or `?` token, so a
+// template produced once by Parse (or cached by a plan cache) can be bound to
+// different values without re-tokenizing. Name is set for `@name` refs; for
+// positional `?` refs Name is empty and Index is its 0-based position among
+// the `?` tokens in the statement.
+type ParamRef struct {
+	Name  string
+	Index int
 }
 
 type Sort struct {
@@ -36,6 +59,20 @@ type Sort struct {
 	Dir string
 }
 
+// JoinSpec is one GABUNG/JOIN (or KIRI GABUNG/LEFT JOIN) clause following a
+// SELECT's primary table. LeftKey and RightKey are qualified "table.field"
+// references taken verbatim from PADA/ON in whatever order they were
+// written - the engine resolves which one actually names a column on Table
+// by its qualifier, not by its position (see resolveJoinKeys in
+// internal/engine/join.go), so "a.x = Table.y" and "Table.y = a.x" behave
+// identically.
+type JoinSpec struct {
+	Table    string
+	Type     string // "INNER" or "LEFT"
+	LeftKey  string
+	RightKey string
+}
+
 type Criteria struct {
 	Type       string // "compound" or ""
 	Conditions []*Criteria
@@ -43,6 +80,14 @@ type Criteria struct {
 	Op         string
 	Val        interface{}
 	Logic      string // AND / OR
+
+	// Fn and Field are set only on a HAVING condition's leaf Criteria (see
+	// parseHaving): Fn is the aggregate function (COUNT, SUM, ...) and
+	// Field is its argument ("*" for COUNT(*)), so the engine can compute
+	// this condition's aggregate from its own field rather than whatever
+	// field the top-level HITUNG happens to aggregate on.
+	Fn    string
+	Field string
 }
 
 func (qp *QueryParser) Tokenize(sql string) []string {
@@ -93,8 +138,20 @@ func (qp *QueryParser) Parse(queryString string, params map[string]interface{})
 		command, err = qp.parseDrop(tokens)
 	case "INDEKS":
 		command, err = qp.parseCreateIndex(tokens)
+	case "REINDEX":
+		command, err = qp.parseReindex(tokens)
 	case "HITUNG":
 		command, err = qp.parseAggregate(tokens)
+	case "LANGGAN", "SUBSCRIBE":
+		command, err = qp.parseSubscribe(tokens)
+	case "MULAI":
+		command, err = qp.parseTxBegin(tokens)
+	case "BEGIN":
+		command = &Command{Type: "TX_BEGIN"}
+	case "SIMPAN", "COMMIT":
+		command = &Command{Type: "TX_COMMIT"}
+	case "BATAL", "ROLLBACK":
+		command = &Command{Type: "TX_ROLLBACK"}
 	default:
 		return &Command{Type: "ERROR", Message: fmt.Sprintf("Perintah tidak dikenal: %s", cmd)}
 	}
@@ -104,7 +161,7 @@ func (qp *QueryParser) Parse(queryString string, params map[string]interface{})
 	}
 
 	if params != nil {
-		qp.bindParameters(command, params)
+		qp.BindParameters(command, params)
 	}
 	return command
 }
@@ -150,6 +207,9 @@ func (qp *QueryParser) parseShow(tokens []string) (*Command, error) {
 			}
 			return &Command{Type: "SHOW_INDEXES", Table: table}, nil
 		}
+		if sub == "CACHE" {
+			return &Command{Type: "SHOW_CACHE"}, nil
+		}
 	} else if cmd == "SHOW" {
 		if sub == "TABLES" {
 			return &Command{Type: "SHOW_TABLES"}, nil
@@ -161,8 +221,11 @@ func (qp *QueryParser) parseShow(tokens []string) (*Command, error) {
 			}
 			return &Command{Type: "SHOW_INDEXES", Table: table}, nil
 		}
+		if sub == "CACHE" {
+			return &Command{Type: "SHOW_CACHE"}, nil
+		}
 	}
-	return nil, errors.New("Syntax: LIHAT LAHAN | SHOW TABLES | LIHAT INDEKS [table] | SHOW INDEXES")
+	return nil, errors.New("Syntax: LIHAT LAHAN | SHOW TABLES | LIHAT INDEKS [table] | SHOW INDEXES | SHOW CACHE")
 }
 
 func (qp *QueryParser) parseDrop(tokens []string) (*Command, error) {
@@ -220,44 +283,102 @@ func (qp *QueryParser) parseInsert(tokens []string) (*Command, error) {
 	}
 	i++
 
-	vals := []interface{}{}
-	if tokens[i] == "(" {
+	rows := []map[string]interface{}{}
+	tupleIdx := 0
+	pidx := 0
+	for {
+		if i >= len(tokens) || tokens[i] != "(" {
+			return nil, fmt.Errorf("Tuple %d: Syntax: ... VALUES (val1, ...)", tupleIdx)
+		}
 		i++
+
+		vals := []interface{}{}
 		for tokens[i] != ")" {
 			if tokens[i] != "," {
-				valStr := tokens[i]
-				var val interface{} = valStr
-				if strings.HasPrefix(valStr, "'") || strings.HasPrefix(valStr, "\"") {
-					val = valStr[1 : len(valStr)-1]
-				} else if strings.ToUpper(valStr) == "NULL" {
-					val = nil
-				} else if strings.ToUpper(valStr) == "TRUE" {
-					val = true
-				} else if strings.ToUpper(valStr) == "FALSE" {
-					val = false
-				} else {
-					if f, err := strconv.ParseFloat(valStr, 64); err == nil {
-						val = f
-					}
-				}
-				vals = append(vals, val)
+				vals = append(vals, parseInsertVal(tokens[i], &pidx))
 			}
 			i++
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("Tuple %d: Unclosed parenthesis in values", tupleIdx)
+			}
 		}
-	} else {
-		return nil, errors.New("Syntax: ... VALUES (val1, ...)")
+		i++ // skip )
+
+		if len(cols) != len(vals) {
+			return nil, fmt.Errorf("Tuple %d: Columns and Values count mismatch", tupleIdx)
+		}
+
+		row := make(map[string]interface{})
+		for k := 0; k < len(cols); k++ {
+			row[cols[k]] = vals[k]
+		}
+		rows = append(rows, row)
+		tupleIdx++
+
+		if i < len(tokens) && tokens[i] == "," {
+			i++
+			continue
+		}
+		break
 	}
 
-	if len(cols) != len(vals) {
-		return nil, errors.New("Columns and Values count mismatch")
+	cmd := &Command{Type: "INSERT", Table: table, Rows: rows}
+	if len(rows) == 1 {
+		cmd.Data = rows[0]
 	}
+	return cmd, nil
+}
+
+// readQualified consumes the field reference at tokens[*i], advancing *i past
+// it, and returns its name. A JOINed SELECT brings columns from more than one
+// table into scope, so the tokenizer's "." may follow: "karet.id" arrives as
+// three tokens ("karet", ".", "id") and is joined back into "karet.id" here.
+func readQualified(tokens []string, i *int) string {
+	name := tokens[*i]
+	*i++
+	if *i+1 < len(tokens) && tokens[*i] == "." {
+		name = name + "." + tokens[*i+1]
+		*i += 2
+	}
+	return name
+}
 
-	data := make(map[string]interface{})
-	for k := 0; k < len(cols); k++ {
-		data[cols[k]] = vals[k]
+// paramRef recognises a `@name` or `?` token and returns the ParamRef it
+// stands for. pidx counts `?` tokens as they're seen so each one gets a
+// distinct 0-based Index within the statement.
+func paramRef(tok string, pidx *int) (ParamRef, bool) {
+	if tok == "?" {
+		ref := ParamRef{Index: *pidx}
+		*pidx++
+		return ref, true
 	}
+	if strings.HasPrefix(tok, "@") {
+		return ParamRef{Name: tok[1:], Index: -1}, true
+	}
+	return ParamRef{}, false
+}
 
-	return &Command{Type: "INSERT", Table: table, Data: data}, nil
+// parseInsertVal mirrors normalizeVal but also recognises NULL/TRUE/FALSE literals,
+// as used by TANAM/INSERT value tuples.
+func parseInsertVal(valStr string, pidx *int) interface{} {
+	if ref, ok := paramRef(valStr, pidx); ok {
+		return ref
+	}
+	if strings.HasPrefix(valStr, "'") || strings.HasPrefix(valStr, "\"") {
+		return valStr[1 : len(valStr)-1]
+	}
+	switch strings.ToUpper(valStr) {
+	case "NULL":
+		return nil
+	case "TRUE":
+		return true
+	case "FALSE":
+		return false
+	}
+	if f, err := strconv.ParseFloat(valStr, 64); err == nil {
+		return f
+	}
+	return valStr
 }
 
 func (qp *QueryParser) parseSelect(tokens []string) (*Command, error) {
@@ -270,10 +391,11 @@ func (qp *QueryParser) parseSelect(tokens []string) (*Command, error) {
 		if upper == "DARI" || upper == "FROM" {
 			break
 		}
-		if tokens[i] != "," {
-			cols = append(cols, tokens[i])
+		if tokens[i] == "," {
+			i++
+			continue
 		}
-		i++
+		cols = append(cols, readQualified(tokens, &i))
 	}
 
 	if i >= len(tokens) {
@@ -284,12 +406,49 @@ func (qp *QueryParser) parseSelect(tokens []string) (*Command, error) {
 	table := tokens[i]
 	i++
 
+	joins := []JoinSpec{}
+	for i < len(tokens) {
+		upper := strings.ToUpper(tokens[i])
+		joinType := ""
+		if upper == "GABUNG" || upper == "JOIN" {
+			joinType = "INNER"
+			i++
+		} else if (upper == "KIRI" || upper == "LEFT") && i+1 < len(tokens) &&
+			(strings.ToUpper(tokens[i+1]) == "GABUNG" || strings.ToUpper(tokens[i+1]) == "JOIN") {
+			joinType = "LEFT"
+			i += 2
+		} else {
+			break
+		}
+
+		if i >= len(tokens) {
+			return nil, errors.New("Syntax: ... GABUNG/JOIN [table] PADA/ON a.field = b.field")
+		}
+		joinTable := tokens[i]
+		i++
+
+		if i >= len(tokens) || (strings.ToUpper(tokens[i]) != "PADA" && strings.ToUpper(tokens[i]) != "ON") {
+			return nil, errors.New("Syntax: ... GABUNG/JOIN [table] PADA/ON a.field = b.field")
+		}
+		i++
+
+		leftKey := readQualified(tokens, &i)
+		if i >= len(tokens) || tokens[i] != "=" {
+			return nil, errors.New("Syntax: ... PADA/ON a.field = b.field")
+		}
+		i++
+		rightKey := readQualified(tokens, &i)
+
+		joins = append(joins, JoinSpec{Table: joinTable, Type: joinType, LeftKey: leftKey, RightKey: rightKey})
+	}
+
 	var criteria *Criteria
+	pidx := 0
 	if i < len(tokens) {
 		upper := strings.ToUpper(tokens[i])
 		if upper == "DIMANA" || upper == "WHERE" {
 			i++
-			criteria = qp.parseWhere(tokens, &i)
+			criteria = qp.parseWhere(tokens, &i, &pidx)
 		}
 	}
 
@@ -303,8 +462,7 @@ func (qp *QueryParser) parseSelect(tokens []string) (*Command, error) {
 		if i < len(tokens) && strings.ToUpper(tokens[i]) == "BY" {
 			i++
 		}
-		key := tokens[i]
-		i++
+		key := readQualified(tokens, &i)
 		dir := "asc"
 		if i < len(tokens) {
 			upper := strings.ToUpper(tokens[i])
@@ -334,11 +492,11 @@ func (qp *QueryParser) parseSelect(tokens []string) (*Command, error) {
 
 	return &Command{
 		Type: "SELECT", Table: table, Cols: cols, Criteria: criteria,
-		Sort: sort, Limit: limitVal, Offset: offsetVal,
+		Sort: sort, Limit: limitVal, Offset: offsetVal, Joins: joins,
 	}, nil
 }
 
-func (qp *QueryParser) parseWhere(tokens []string, refIndex *int) *Criteria {
+func (qp *QueryParser) parseWhere(tokens []string, refIndex *int, pidx *int) *Criteria {
 	conditions := []*Criteria{}
 	i := *refIndex
 	currentLogic := "AND"
@@ -357,66 +515,68 @@ func (qp *QueryParser) parseWhere(tokens []string, refIndex *int) *Criteria {
 			break
 		}
 
-		// Key Op Val
-		if i < len(tokens)-1 {
-			key := tokens[i]
-			op := strings.ToUpper(tokens[i+1])
-
-			// Handle BETWEEN, IS, IN etc.
-			// Similar to JS logic...
-
-			consumed := 0
-			var cond *Criteria
-
-			if op == "BETWEEN" {
-				// key BETWEEN v1 AND v2
-				// i=key, i+1=BETWEEN, i+2=v1, i+3=AND, i+4=v2
-				v1 := normalizeVal(tokens[i+2])
-				v2 := normalizeVal(tokens[i+4])
-				cond = &Criteria{Key: key, Op: "BETWEEN", Val: []interface{}{v1, v2}, Logic: currentLogic}
-				consumed = 5
-			} else if op == "IS" {
-				if strings.ToUpper(tokens[i+2]) == "NULL" {
-					cond = &Criteria{Key: key, Op: "IS NULL", Logic: currentLogic}
-					consumed = 3
-				} else {
-					// IS NOT NULL
-					cond = &Criteria{Key: key, Op: "IS NOT NULL", Logic: currentLogic}
-					consumed = 4
-				}
-			} else if op == "IN" || op == "NOT" {
-				finalOp := "IN"
-				p := i + 2
-				if op == "NOT" {
-					finalOp = "NOT IN"
-					p = i + 3 // key NOT IN ...
-				}
+		// Key Op Val. Key may be a qualified "table.field" reference when this
+		// criteria filters a JOINed SELECT.
+		if i >= len(tokens) {
+			break
+		}
+		key := readQualified(tokens, &i)
+		if i >= len(tokens) {
+			break
+		}
+		op := strings.ToUpper(tokens[i])
 
-				// ( v1, v2 )
-				if tokens[p] == "(" {
-					p++
-					vals := []interface{}{}
-					for tokens[p] != ")" {
-						if tokens[p] != "," {
-							vals = append(vals, normalizeVal(tokens[p]))
-						}
-						p++
-					}
-					consumed = (p - i) + 1
-					cond = &Criteria{Key: key, Op: finalOp, Val: vals, Logic: currentLogic}
-				}
+		// Handle BETWEEN, IS, IN etc.
+		// Similar to JS logic...
+
+		consumed := 0
+		var cond *Criteria
+
+		if op == "BETWEEN" {
+			// op=BETWEEN, i+1=v1, i+2=AND, i+3=v2
+			v1 := normalizeVal(tokens[i+1], pidx)
+			v2 := normalizeVal(tokens[i+3], pidx)
+			cond = &Criteria{Key: key, Op: "BETWEEN", Val: []interface{}{v1, v2}, Logic: currentLogic}
+			consumed = 4
+		} else if op == "IS" {
+			if strings.ToUpper(tokens[i+1]) == "NULL" {
+				cond = &Criteria{Key: key, Op: "IS NULL", Logic: currentLogic}
+				consumed = 2
 			} else {
-				// Simple op
-				val := normalizeVal(tokens[i+2])
-				cond = &Criteria{Key: key, Op: op, Val: val, Logic: currentLogic}
+				// IS NOT NULL
+				cond = &Criteria{Key: key, Op: "IS NOT NULL", Logic: currentLogic}
 				consumed = 3
 			}
+		} else if op == "IN" || op == "NOT" {
+			finalOp := "IN"
+			p := i + 1
+			if op == "NOT" {
+				finalOp = "NOT IN"
+				p = i + 2 // key NOT IN ...
+			}
 
-			conditions = append(conditions, cond)
-			i += consumed
+			// ( v1, v2 )
+			if tokens[p] == "(" {
+				p++
+				vals := []interface{}{}
+				for tokens[p] != ")" {
+					if tokens[p] != "," {
+						vals = append(vals, normalizeVal(tokens[p], pidx))
+					}
+					p++
+				}
+				consumed = (p - i) + 1
+				cond = &Criteria{Key: key, Op: finalOp, Val: vals, Logic: currentLogic}
+			}
 		} else {
-			break
+			// Simple op
+			val := normalizeVal(tokens[i+1], pidx)
+			cond = &Criteria{Key: key, Op: op, Val: val, Logic: currentLogic}
+			consumed = 2
 		}
+
+		conditions = append(conditions, cond)
+		i += consumed
 	}
 
 	*refIndex = i
@@ -427,7 +587,10 @@ func (qp *QueryParser) parseWhere(tokens []string, refIndex *int) *Criteria {
 	return &Criteria{Type: "compound", Conditions: conditions}
 }
 
-func normalizeVal(valStr string) interface{} {
+func normalizeVal(valStr string, pidx *int) interface{} {
+	if ref, ok := paramRef(valStr, pidx); ok {
+		return ref
+	}
 	if strings.HasPrefix(valStr, "'") || strings.HasPrefix(valStr, "\"") {
 		return valStr[1 : len(valStr)-1]
 	} else {
@@ -456,11 +619,12 @@ func (qp *QueryParser) parseDelete(tokens []string) (*Command, error) {
 	}
 
 	var criteria *Criteria
+	pidx := 0
 	if i < len(tokens) {
 		upper := strings.ToUpper(tokens[i])
 		if upper == "DIMANA" || upper == "WHERE" {
 			i++
-			criteria = qp.parseWhere(tokens, &i)
+			criteria = qp.parseWhere(tokens, &i, &pidx)
 		}
 	}
 	return &Command{Type: "DELETE", Table: table, Criteria: criteria}, nil
@@ -484,6 +648,7 @@ func (qp *QueryParser) parseUpdate(tokens []string) (*Command, error) {
 	}
 
 	updates := make(map[string]interface{})
+	pidx := 0
 	for i < len(tokens) {
 		upper := strings.ToUpper(tokens[i])
 		if upper == "DIMANA" || upper == "WHERE" {
@@ -496,7 +661,7 @@ func (qp *QueryParser) parseUpdate(tokens []string) (*Command, error) {
 
 		key := tokens[i]
 		// skip =
-		val := normalizeVal(tokens[i+2])
+		val := normalizeVal(tokens[i+2], &pidx)
 		updates[key] = val
 		i += 3
 	}
@@ -504,14 +669,14 @@ func (qp *QueryParser) parseUpdate(tokens []string) (*Command, error) {
 	var criteria *Criteria
 	if i < len(tokens) {
 		i++ // WHERE
-		criteria = qp.parseWhere(tokens, &i)
+		criteria = qp.parseWhere(tokens, &i, &pidx)
 	}
 
 	return &Command{Type: "UPDATE", Table: table, Updates: updates, Criteria: criteria}, nil
 }
 
 func (qp *QueryParser) parseCreateIndex(tokens []string) (*Command, error) {
-	// CREATE INDEX ... ON tbl ( field )
+	// CREATE INDEX ... ON tbl ( field ) [TIPE|TYPE keyType]
 	if strings.ToUpper(tokens[0]) == "CREATE" {
 		i := 2
 		if strings.ToUpper(tokens[i]) != "ON" && len(tokens) > i+1 && strings.ToUpper(tokens[i+1]) == "ON" {
@@ -522,54 +687,266 @@ func (qp *QueryParser) parseCreateIndex(tokens []string) (*Command, error) {
 		i++
 		i++ // (
 		field := tokens[i]
-		// ) done
-		return &Command{Type: "CREATE_INDEX", Table: table, Field: field}, nil
+		i++ // field
+		i++ // )
+		return &Command{Type: "CREATE_INDEX", Table: table, Field: field, KeyType: parseIndexKeyType(tokens, i)}, nil
+	}
+	// INDEKS table PADA field [TIPE|TYPE keyType]
+	return &Command{Type: "CREATE_INDEX", Table: tokens[1], Field: tokens[3], KeyType: parseIndexKeyType(tokens, 4)}, nil
+}
+
+// parseIndexKeyType reads an optional "TIPE keyType" / "TYPE keyType" clause
+// starting at tokens[i], returning "" if absent. keyType is upper-cased so
+// "bytes" and "BYTES" bind the same comparator.
+func parseIndexKeyType(tokens []string, i int) string {
+	if i+1 < len(tokens) {
+		kw := strings.ToUpper(tokens[i])
+		if kw == "TIPE" || kw == "TYPE" {
+			return strings.ToUpper(tokens[i+1])
+		}
+	}
+	return ""
+}
+
+func (qp *QueryParser) parseReindex(tokens []string) (*Command, error) {
+	if len(tokens) < 2 {
+		return nil, errors.New("Syntax: REINDEX [table]")
+	}
+	return &Command{Type: "REINDEX", Table: tokens[1]}, nil
+}
+
+// parseSubscribe handles "LANGGAN tbl [MULAI DARI n]" / "SUBSCRIBE tbl [FROM n]".
+// n may be a literal or a @name/? parameter, resolved later like any other
+// bound value.
+func (qp *QueryParser) parseSubscribe(tokens []string) (*Command, error) {
+	if len(tokens) < 2 {
+		return nil, errors.New("Syntax: LANGGAN [tabel] | SUBSCRIBE [table]")
+	}
+	table := tokens[1]
+	i := 2
+
+	var fromLSN interface{}
+	if i < len(tokens) {
+		upper := strings.ToUpper(tokens[i])
+		switch upper {
+		case "MULAI":
+			if i+2 >= len(tokens) || strings.ToUpper(tokens[i+1]) != "DARI" {
+				return nil, errors.New("Syntax: LANGGAN [tabel] MULAI DARI [lsn]")
+			}
+			pidx := 0
+			fromLSN = normalizeVal(tokens[i+2], &pidx)
+			i += 3
+		case "FROM":
+			if i+1 >= len(tokens) {
+				return nil, errors.New("Syntax: SUBSCRIBE [table] FROM [lsn]")
+			}
+			pidx := 0
+			fromLSN = normalizeVal(tokens[i+1], &pidx)
+			i += 2
+		}
+	}
+
+	return &Command{Type: "SUBSCRIBE", Table: table, FromLSN: fromLSN}, nil
+}
+
+func (qp *QueryParser) parseTxBegin(tokens []string) (*Command, error) {
+	if len(tokens) < 2 || strings.ToUpper(tokens[1]) != "TRANSAKSI" {
+		return nil, errors.New("Syntax: MULAI TRANSAKSI | BEGIN")
 	}
-	// INDEKS table PADA field
-	return &Command{Type: "CREATE_INDEX", Table: tokens[1], Field: tokens[3]}, nil
+	return &Command{Type: "TX_BEGIN"}, nil
 }
 
 func (qp *QueryParser) parseAggregate(tokens []string) (*Command, error) {
 	i := 1
-	funcValid := strings.ToUpper(tokens[i])
+	fn := strings.ToUpper(tokens[i])
 	i++
-	i++ // (
+
+	if i >= len(tokens) || tokens[i] != "(" {
+		return nil, errors.New("Syntax: HITUNG FUNC(field) DARI [table]")
+	}
+	i++
+
+	distinct := false
+	if fn == "COUNT" && i < len(tokens) && strings.ToUpper(tokens[i]) == "DISTINCT" {
+		distinct = true
+		i++
+	}
+
 	aggField := tokens[i]
 	if aggField == "*" {
 		aggField = ""
-	} // Logic in JS handles null
+	}
+	i++
+
+	concatOrderKey, concatOrderDir, concatSeparator := "", "", ""
+	if fn == "GROUP_CONCAT" {
+		if i < len(tokens) && strings.ToUpper(tokens[i]) == "ORDER" {
+			i++
+			if i < len(tokens) && strings.ToUpper(tokens[i]) == "BY" {
+				i++
+			}
+			concatOrderKey = tokens[i]
+			i++
+			concatOrderDir = "asc"
+			if i < len(tokens) {
+				up := strings.ToUpper(tokens[i])
+				if up == "ASC" || up == "DESC" {
+					concatOrderDir = strings.ToLower(up)
+					i++
+				}
+			}
+		}
+		concatSeparator = ","
+		if i < len(tokens) && strings.ToUpper(tokens[i]) == "SEPARATOR" {
+			i++
+			sep := tokens[i]
+			if strings.HasPrefix(sep, "'") || strings.HasPrefix(sep, "\"") {
+				sep = sep[1 : len(sep)-1]
+			}
+			concatSeparator = sep
+			i++
+		}
+	}
+
+	if i >= len(tokens) || tokens[i] != ")" {
+		return nil, errors.New("Syntax: HITUNG FUNC(field[, options]) DARI [table]")
+	}
+	i++
+
+	if i >= len(tokens) || (strings.ToUpper(tokens[i]) != "DARI" && strings.ToUpper(tokens[i]) != "FROM") {
+		return nil, errors.New("Expected DARI or FROM")
+	}
 	i++
-	i++ // )
-	i++ // DARI
 	table := tokens[i]
 	i++
 
 	var criteria *Criteria
+	pidx := 0
 	if i < len(tokens) && (strings.ToUpper(tokens[i]) == "DIMANA" || strings.ToUpper(tokens[i]) == "WHERE") {
 		i++
-		criteria = qp.parseWhere(tokens, &i)
+		criteria = qp.parseWhere(tokens, &i, &pidx)
 	}
 
-	groupBy := ""
+	groupBy := []string{}
 	if i < len(tokens) && (strings.ToUpper(tokens[i]) == "KELOMPOK" || strings.ToUpper(tokens[i]) == "GROUP") {
-		// GROUP BY
 		if strings.ToUpper(tokens[i]) == "GROUP" {
 			i++
+			if i < len(tokens) && strings.ToUpper(tokens[i]) == "BY" {
+				i++
+			}
+		} else {
+			i++
+		}
+		for i < len(tokens) {
+			up := strings.ToUpper(tokens[i])
+			if up == "PUNYA" || up == "HAVING" || up == "ORDER" || up == "LIMIT" || up == "OFFSET" {
+				break
+			}
+			if tokens[i] != "," {
+				groupBy = append(groupBy, tokens[i])
+			}
+			i++
+		}
+	}
+
+	var having *Criteria
+	if i < len(tokens) && (strings.ToUpper(tokens[i]) == "PUNYA" || strings.ToUpper(tokens[i]) == "HAVING") {
+		i++
+		having = qp.parseHaving(tokens, &i, &pidx)
+	}
+
+	return &Command{
+		Type: "AGGREGATE", Table: table, Func: fn, Field: aggField, Criteria: criteria,
+		GroupBy: groupBy, Having: having, Distinct: distinct,
+		ConcatOrderKey: concatOrderKey, ConcatOrderDir: concatOrderDir, ConcatSeparator: concatSeparator,
+	}, nil
+}
+
+// parseHaving parses a PUNYA/HAVING clause following KELOMPOK. Unlike
+// parseWhere, the left-hand side of each condition is an aggregate function
+// call (e.g. COUNT(*), SUM(produksi)) rather than a plain field, since HAVING
+// filters on the result of the grouping, not the raw rows. Each call is
+// collapsed to the same key the aggregator stores its result under.
+func (qp *QueryParser) parseHaving(tokens []string, refIndex *int, pidx *int) *Criteria {
+	conditions := []*Criteria{}
+	i := *refIndex
+	currentLogic := "AND"
+
+	for i < len(tokens) {
+		upper := strings.ToUpper(tokens[i])
+		if upper == "AND" || upper == "OR" {
+			currentLogic = upper
+			i++
+			continue
+		}
+		if upper == "ORDER" || upper == "LIMIT" || upper == "OFFSET" {
+			break
+		}
+
+		fn := upper
+		i++
+		if i >= len(tokens) || tokens[i] != "(" {
+			break
 		}
 		i++
-		groupBy = tokens[i]
+		if i >= len(tokens) {
+			break
+		}
+		field := tokens[i]
+		i++
+		if i >= len(tokens) || tokens[i] != ")" {
+			break
+		}
+		i++
+
+		if i+1 >= len(tokens) {
+			break
+		}
+		op := strings.ToUpper(tokens[i])
+		val := normalizeVal(tokens[i+1], pidx)
+		conditions = append(conditions, &Criteria{Key: havingKey(fn, field), Fn: fn, Field: field, Op: op, Val: val, Logic: currentLogic})
+		i += 2
 	}
 
-	return &Command{Type: "AGGREGATE", Table: table, Func: funcValid, Field: aggField, Criteria: criteria, GroupBy: groupBy}, nil
+	*refIndex = i
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return &Criteria{Type: "compound", Conditions: conditions}
+}
+
+// havingKey names the result-map key a HAVING condition's aggregate is
+// checked against. COUNT(*)-shaped calls (no real field argument) keep the
+// bare function name so they line up with HITUNG's own "count"/"sum"/...
+// output when it happens to aggregate the same way; a condition naming a
+// real field is suffixed with it so PUNYA SUM(a) and PUNYA SUM(b) don't
+// collide in the same result row.
+func havingKey(fn, field string) string {
+	base := strings.ToLower(fn)
+	if field == "" || field == "*" {
+		return base
+	}
+	return base + "_" + field
 }
 
-func (qp *QueryParser) bindParameters(command *Command, params map[string]interface{}) {
+// BindParameters resolves every ParamRef left in command by a `@name` or `?`
+// token against params, keyed by name for `@name` refs and by the decimal
+// string of its position (e.g. "0", "1", ...) for positional `?` refs. A ref
+// with no matching entry in params is left unresolved. Exported so callers
+// that parse once and bind repeatedly (e.g. a prepared-statement plan cache)
+// can bind a cloned Command without going through Parse again.
+func (qp *QueryParser) BindParameters(command *Command, params map[string]interface{}) {
 	bindValue := func(val interface{}) interface{} {
-		if s, ok := val.(string); ok && strings.HasPrefix(s, "@") {
-			name := s[1:]
-			if v, ok := params[name]; ok {
-				return v
-			}
+		ref, ok := val.(ParamRef)
+		if !ok {
+			return val
+		}
+		key := ref.Name
+		if key == "" {
+			key = strconv.Itoa(ref.Index)
+		}
+		if v, ok := params[key]; ok {
+			return v
 		}
 		return val
 	}
@@ -577,11 +954,27 @@ func (qp *QueryParser) bindParameters(command *Command, params map[string]interf
 	if command.Criteria != nil {
 		qp.bindCriteria(command.Criteria, bindValue)
 	}
-	if command.Data != nil {
+	if command.Having != nil {
+		qp.bindCriteria(command.Having, bindValue)
+	}
+	if command.Rows != nil {
+		// Data aliases Rows[0] for single-tuple inserts, so binding Rows covers it too.
+		for _, row := range command.Rows {
+			for k, v := range row {
+				row[k] = bindValue(v)
+			}
+		}
+	} else if command.Data != nil {
 		for k, v := range command.Data {
 			command.Data[k] = bindValue(v)
 		}
 	}
+	for k, v := range command.Updates {
+		command.Updates[k] = bindValue(v)
+	}
+	if command.FromLSN != nil {
+		command.FromLSN = bindValue(command.FromLSN)
+	}
 }
 
 func (qp *QueryParser) bindCriteria(c *Criteria, bindFunc func(interface{}) interface{}) {
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/WowoEngine/SawitDB-Go/internal/engine"
+	"github.com/WowoEngine/SawitDB-Go/internal/log"
+)
+
+// binaryFramingVersion is the framing protocol this server advertises in its
+// welcome frame. A client that recognizes it (see pkg/client's
+// negotiateFraming) opts in with a "hello" request; one that doesn't simply
+// never sends "hello", and handleConnection keeps serving it with the
+// request loop of whichever codec wire.Detect picked for the connection.
+const binaryFramingVersion = "binary/v1"
+
+// Frame types for the binary framing protocol. A frame is
+// [uint32 length][uint8 type][uint64 requestID][JSON payload], where length
+// counts everything after itself. frameTypeRequest is client -> server; the
+// rest are server -> client.
+const (
+	frameTypeRequest  byte = 1
+	frameTypeResponse byte = 2
+	frameTypeChunk    byte = 3
+	frameTypeEnd      byte = 4
+	frameTypeEvent    byte = 5
+)
+
+const frameHeaderLen = 4 + 1 + 8 // length + type + requestID
+
+// streamChunkSize caps how many rows ride in a single result_chunk frame of
+// a streamed query, so a large range/scan doesn't force the server to
+// buffer its whole reply into one oversized frame before the client sees
+// anything.
+const streamChunkSize = 200
+
+func readFrame(r *bufio.Reader) (typ byte, reqID uint64, payload []byte, err error) {
+	header := make([]byte, frameHeaderLen)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	typ = header[4]
+	reqID = binary.BigEndian.Uint64(header[5:13])
+	payload = make([]byte, int(length)-(1+8))
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+func (s *SawitServer) sendFrame(conn net.Conn, typ byte, reqID uint64, data map[string]interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, frameHeaderLen)
+	binary.BigEndian.PutUint32(header[0:4], uint32(1+8+len(payload)))
+	header[4] = typ
+	binary.BigEndian.PutUint64(header[5:13], reqID)
+
+	lockAny, _ := s.writeLocks.LoadOrStore(conn, &sync.Mutex{})
+	lock := lockAny.(*sync.Mutex)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := conn.Write(header); err != nil {
+		return err
+	}
+	_, err = conn.Write(payload)
+	return err
+}
+
+// requestResponder is the reply path handleRequest and everything it calls
+// write through. responder (below) is the TCP/WebSocket implementation;
+// httpResponder (see http.go) answers a REST call the same way, so
+// handleRequest stays the one canonical place a request is dispatched
+// regardless of which listener it arrived on.
+type requestResponder interface {
+	send(data map[string]interface{}) error
+	sendErr(msg string)
+	sendEvent(data map[string]interface{}) error
+	sendChunk(data map[string]interface{}) error
+	sendEnd(data map[string]interface{}) error
+}
+
+// responder abstracts a single request's reply path over the two wire
+// formats this server speaks: the legacy per-connection newline-JSON loop
+// (reqID nil, every frame is just a response line) and binary framing
+// (reqID tags every frame so the client's background reader can demux
+// replies, chunks, and pushed events for requests that pipeline on the same
+// connection).
+type responder struct {
+	server *SawitServer
+	conn   net.Conn
+	reqID  *uint64
+}
+
+func (r *responder) send(data map[string]interface{}) error {
+	if r.reqID == nil {
+		return r.server.sendResponse(r.conn, data)
+	}
+	return r.server.sendFrame(r.conn, frameTypeResponse, *r.reqID, data)
+}
+
+func (r *responder) sendErr(msg string) {
+	r.send(map[string]interface{}{"type": "error", "error": msg})
+}
+
+// sendEvent delivers a frame pushed after the initial reply has already
+// gone out (e.g. a LANGGAN/SUBSCRIBE change event). Under framing it's
+// tagged frameTypeEvent so it isn't mistaken for the single frameTypeResponse
+// the original request is waiting on; the legacy loop has no such
+// distinction - the client there just reads every line generically.
+func (r *responder) sendEvent(data map[string]interface{}) error {
+	if r.reqID == nil {
+		return r.server.sendResponse(r.conn, data)
+	}
+	return r.server.sendFrame(r.conn, frameTypeEvent, *r.reqID, data)
+}
+
+func (r *responder) sendChunk(data map[string]interface{}) error {
+	if r.reqID == nil {
+		return r.server.sendResponse(r.conn, data)
+	}
+	return r.server.sendFrame(r.conn, frameTypeChunk, *r.reqID, data)
+}
+
+func (r *responder) sendEnd(data map[string]interface{}) error {
+	if r.reqID == nil {
+		return r.server.sendResponse(r.conn, data)
+	}
+	return r.server.sendFrame(r.conn, frameTypeEnd, *r.reqID, data)
+}
+
+// handleHello answers a client's opt-in to binary framing. It reports
+// whether negotiation succeeded; on success the caller switches the
+// connection over to framedLoop.
+func (s *SawitServer) handleHello(conn net.Conn, req map[string]interface{}) bool {
+	payload, _ := req["payload"].(map[string]interface{})
+	framing, _ := payload["framing"].(string)
+	if framing != binaryFramingVersion {
+		s.sendError(conn, "Versi framing tidak didukung: "+framing)
+		return false
+	}
+	s.sendResponse(conn, map[string]interface{}{"type": "hello_ack", "framing": binaryFramingVersion})
+	return true
+}
+
+// framedLoop replaces handleConnection's newline-JSON read loop once a
+// client negotiates binary framing via handleHello. Each frame is dispatched
+// to its own goroutine, so a slow query can't hold up a Ping (or any other
+// request) pipelined right behind it on the same connection - only the read
+// loop itself is single-threaded, same as the JSON loop it replaces.
+func (s *SawitServer) framedLoop(conn net.Conn, reader *bufio.Reader, authenticated *bool, currentDatabase *string, currentUser *string, currentTx **engine.Tx, connID string) {
+	for {
+		typ, reqID, raw, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				s.Logger.With(log.Str("client_id", connID)).Error("Frame read error", log.Err(err))
+			}
+			return
+		}
+		if typ != frameTypeRequest {
+			continue
+		}
+
+		var req map[string]interface{}
+		if err := json.Unmarshal(raw, &req); err != nil {
+			s.sendFrame(conn, frameTypeResponse, reqID, map[string]interface{}{"type": "error", "error": "Invalid request format: " + err.Error()})
+			continue
+		}
+
+		id := reqID
+		r := &responder{server: s, conn: conn, reqID: &id}
+		go s.handleRequest(r, req, authenticated, currentDatabase, currentUser, currentTx, connID)
+	}
+}
+
+// sendQueryStream replies to a streamed query as a sequence of result_chunk
+// frames followed by end_of_stream, instead of one query_result frame,
+// so the client can start seeing rows before the whole result set is on the
+// wire. A result that isn't a row set (e.g. a plain status message) has
+// nothing to page, so it rides as a single chunk.
+func (s *SawitServer) sendQueryStream(r requestResponder, res interface{}, query string, duration int64) {
+	rows, ok := res.([]map[string]interface{})
+	if !ok {
+		r.sendChunk(map[string]interface{}{"type": "result_chunk", "rows": []interface{}{res}})
+		r.sendEnd(map[string]interface{}{"type": "end_of_stream", "query": query, "executionTime": duration})
+		return
+	}
+
+	for i := 0; i < len(rows); i += streamChunkSize {
+		end := i + streamChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := make([]interface{}, end-i)
+		for j, row := range rows[i:end] {
+			chunk[j] = row
+		}
+		if err := r.sendChunk(map[string]interface{}{"type": "result_chunk", "rows": chunk}); err != nil {
+			return
+		}
+	}
+	r.sendEnd(map[string]interface{}{"type": "end_of_stream", "query": query, "executionTime": duration})
+}
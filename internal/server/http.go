@@ -0,0 +1,311 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/WowoEngine/SawitDB-Go/internal/auth"
+	"github.com/WowoEngine/SawitDB-Go/internal/engine"
+	"github.com/WowoEngine/SawitDB-Go/internal/log"
+)
+
+// startHTTP serves the REST gateway and the /v1/stream WebSocket tunnel
+// alongside the TCP protocol, on Config.HTTPPort. It's launched from Start
+// in its own goroutine, so a REST-only deployment still has to set Port to
+// something reachable - there's always a TCP listener, HTTPPort just adds
+// a second front door onto the same Databases/Sessions/Cluster state.
+func (s *SawitServer) startHTTP() {
+	addr := fmt.Sprintf("%s:%d", s.Config.Host, s.Config.HTTPPort)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/query", s.withCORS(s.httpQuery))
+	mux.HandleFunc("/v1/databases", s.withCORS(s.httpDatabases))
+	mux.HandleFunc("/v1/databases/", s.withCORS(s.httpDatabaseByName))
+	mux.HandleFunc("/v1/stats", s.withCORS(s.httpStats))
+	mux.HandleFunc("/v1/healthz", s.withCORS(s.httpHealthz))
+	mux.HandleFunc("/v1/stream", s.handleWebSocketUpgrade)
+	mux.HandleFunc("/metrics", s.httpMetrics)
+
+	fmt.Printf("[Server] HTTP gateway listening on %s\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Printf("[Server] HTTP gateway error: %v\n", err)
+	}
+}
+
+// withCORS applies Config.CORSOrigins to a handler and answers the
+// preflight OPTIONS request browsers send ahead of a cross-origin POST/
+// DELETE. A server with no CORSOrigins configured sends no CORS headers at
+// all, same as before the HTTP gateway existed.
+func (s *SawitServer) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if origin := s.corsOrigin(req.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		}
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, req)
+	}
+}
+
+func (s *SawitServer) corsOrigin(requestOrigin string) string {
+	for _, allowed := range s.Config.CORSOrigins {
+		if allowed == "*" || allowed == requestOrigin {
+			return allowed
+		}
+	}
+	return ""
+}
+
+// httpAuthenticate resolves the caller's username from either a bearer
+// session token or HTTP Basic credentials - REST calls are stateless, so
+// there's no persistent currentUser to carry across requests the way a TCP
+// connection has. A server with no Config.Users always reports "no auth
+// needed", same as the TCP protocol.
+func (s *SawitServer) httpAuthenticate(req *http.Request) (string, bool) {
+	if s.Config.Users == nil {
+		return "", true
+	}
+	if token := bearerToken(req); token != "" {
+		sess, ok := s.Sessions.Lookup(token)
+		if !ok {
+			return "", false
+		}
+		return sess.Username, true
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	user, ok := s.Config.Users[username]
+	if !ok || !auth.VerifyPassword(password, user.PasswordHash) {
+		return "", false
+	}
+	return username, true
+}
+
+func bearerToken(req *http.Request) string {
+	const prefix = "Bearer "
+	h := req.Header.Get("Authorization")
+	if strings.HasPrefix(h, prefix) {
+		return strings.TrimPrefix(h, prefix)
+	}
+	return ""
+}
+
+// httpQuery is POST /v1/query. It builds the same currentDb/currentTx
+// state a TCP connection threads through handleQuery, just scoped to a
+// single request instead of a connection's lifetime - a tx_id in the body
+// lets a REST call join a transaction begun over TCP or WebSocket.
+func (s *SawitServer) httpQuery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Database string                 `json:"database"`
+		Query    string                 `json:"query"`
+		Params   map[string]interface{} `json:"params"`
+		TxID     string                 `json:"tx_id"`
+		Stream   bool                   `json:"stream"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, ok := s.httpAuthenticate(req)
+	if s.Config.Users != nil && !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	currentDb := body.Database
+	var currentTx *engine.Tx
+	logger := s.Logger.With(log.Str("req_id", newShortID()), log.Str("transport", "http"))
+	s.handleQuery(newHTTPResponder(w), body.Query, body.Params, body.Stream, &currentDb, username, &currentTx, body.TxID, logger)
+}
+
+// httpDatabases is GET/POST /v1/databases.
+func (s *SawitServer) httpDatabases(w http.ResponseWriter, req *http.Request) {
+	username, ok := s.httpAuthenticate(req)
+	if s.Config.Users != nil && !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		dbs, err := s.listDatabases()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]interface{}{"databases": dbs, "count": len(dbs)})
+
+	case http.MethodPost:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Name == "" {
+			http.Error(w, "database name required", http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(username, body.Name, auth.RoleAdmin) {
+			http.Error(w, "access denied: creating a database requires the admin role", http.StatusForbidden)
+			return
+		}
+		if _, err := s.getOrCreateDatabase(body.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, http.StatusCreated, map[string]interface{}{"database": body.Name, "message": "created"})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// httpDatabaseByName is DELETE /v1/databases/{name}, reusing
+// handleDropDatabase so a REST drop behaves identically to the TCP
+// "drop_database" request. Unlike the BAKAR WILAYAH / DROP DATABASE query
+// path, neither one replicates the drop to a cluster.
+func (s *SawitServer) httpDatabaseByName(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/v1/databases/")
+	if name == "" {
+		http.Error(w, "database name required", http.StatusBadRequest)
+		return
+	}
+
+	username, ok := s.httpAuthenticate(req)
+	if s.Config.Users != nil && !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !s.authorize(username, name, auth.RoleAdmin) {
+		http.Error(w, "access denied: dropping a database requires the admin role", http.StatusForbidden)
+		return
+	}
+
+	var currentDb string
+	s.handleDropDatabase(newHTTPResponder(w), name, &currentDb)
+}
+
+func (s *SawitServer) httpStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.Mu.Lock()
+	stats := s.Stats
+	s.Mu.Unlock()
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"stats": stats})
+}
+
+func (s *SawitServer) httpHealthz(w http.ResponseWriter, req *http.Request) {
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// httpMetrics publishes ServerStats and queryDurations in Prometheus's
+// text exposition format by hand - see queryDurationHistogram's doc
+// comment in metrics.go for why there's no client library backing this.
+func (s *SawitServer) httpMetrics(w http.ResponseWriter, req *http.Request) {
+	s.Mu.Lock()
+	stats := s.Stats
+	s.Mu.Unlock()
+	buckets, count, sum := s.queryDurations.snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprint(w, "# HELP sawitdb_active_connections Current number of open client connections.\n")
+	fmt.Fprint(w, "# TYPE sawitdb_active_connections gauge\n")
+	fmt.Fprintf(w, "sawitdb_active_connections %d\n", stats.ActiveConnections)
+
+	fmt.Fprint(w, "# HELP sawitdb_queries_total Total number of queries executed since startup.\n")
+	fmt.Fprint(w, "# TYPE sawitdb_queries_total counter\n")
+	fmt.Fprintf(w, "sawitdb_queries_total %d\n", stats.TotalQueries)
+
+	fmt.Fprint(w, "# HELP sawitdb_errors_total Total number of query errors since startup.\n")
+	fmt.Fprint(w, "# TYPE sawitdb_errors_total counter\n")
+	fmt.Fprintf(w, "sawitdb_errors_total %d\n", stats.Errors)
+
+	fmt.Fprint(w, "# HELP sawitdb_query_duration_seconds Query execution time.\n")
+	fmt.Fprint(w, "# TYPE sawitdb_query_duration_seconds histogram\n")
+	for _, b := range buckets {
+		fmt.Fprintf(w, "sawitdb_query_duration_seconds_bucket{le=\"%s\"} %d\n", b.label, b.count)
+	}
+	fmt.Fprintf(w, "sawitdb_query_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "sawitdb_query_duration_seconds_sum %g\n", sum)
+	fmt.Fprintf(w, "sawitdb_query_duration_seconds_count %d\n", count)
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// httpResponder adapts http.ResponseWriter to requestResponder, so a REST
+// call runs through the exact same handleRequest/handleQuery dispatch a
+// TCP or WebSocket client's query does. A non-streaming reply is a single
+// JSON object; a streamed one (stream: true in the request body) falls
+// back to newline-delimited JSON chunks, flushed as they arrive, mirroring
+// the framing the legacy TCP protocol uses.
+type httpResponder struct {
+	w           http.ResponseWriter
+	wroteHeader bool
+}
+
+func newHTTPResponder(w http.ResponseWriter) *httpResponder {
+	return &httpResponder{w: w}
+}
+
+func (h *httpResponder) writeJSON(status int, data map[string]interface{}) error {
+	if !h.wroteHeader {
+		h.w.Header().Set("Content-Type", "application/json")
+		h.w.WriteHeader(status)
+		h.wroteHeader = true
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := h.w.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	if flusher, ok := h.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (h *httpResponder) send(data map[string]interface{}) error {
+	return h.writeJSON(http.StatusOK, data)
+}
+
+func (h *httpResponder) sendErr(msg string) {
+	h.writeJSON(http.StatusBadRequest, map[string]interface{}{"type": "error", "error": msg})
+}
+
+func (h *httpResponder) sendEvent(data map[string]interface{}) error {
+	return h.writeJSON(http.StatusOK, data)
+}
+
+func (h *httpResponder) sendChunk(data map[string]interface{}) error {
+	return h.writeJSON(http.StatusOK, data)
+}
+
+func (h *httpResponder) sendEnd(data map[string]interface{}) error {
+	return h.writeJSON(http.StatusOK, data)
+}
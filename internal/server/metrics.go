@@ -0,0 +1,59 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+)
+
+// durationBucket is one fixed upper bound (in seconds) of the
+// sawitdb_query_duration_seconds histogram /metrics publishes. count is
+// cumulative - it includes every observation less than or equal to le, the
+// same convention Prometheus's own histogram type uses.
+type durationBucket struct {
+	label string
+	le    float64
+	count uint64
+}
+
+// queryDurationHistogram is a minimal, hand-rolled stand-in for the
+// Prometheus client library's histogram type - pulling that library in
+// would be this project's first third-party dependency, and a handful of
+// fixed buckets doesn't need anything more.
+type queryDurationHistogram struct {
+	mu      sync.Mutex
+	buckets []durationBucket
+	count   uint64
+	sum     float64
+}
+
+func newQueryDurationHistogram() *queryDurationHistogram {
+	bounds := []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	h := &queryDurationHistogram{}
+	for _, b := range bounds {
+		h.buckets = append(h.buckets, durationBucket{label: strconv.FormatFloat(b, 'g', -1, 64), le: b})
+	}
+	return h
+}
+
+// observe records one query's wall-clock time, in seconds.
+func (h *queryDurationHistogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += seconds
+	for i := range h.buckets {
+		if seconds <= h.buckets[i].le {
+			h.buckets[i].count++
+		}
+	}
+}
+
+// snapshot returns a point-in-time copy of the buckets plus the overall
+// count and sum, safe to read from without holding h.mu.
+func (h *queryDurationHistogram) snapshot() ([]durationBucket, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]durationBucket, len(h.buckets))
+	copy(out, h.buckets)
+	return out, h.count, h.sum
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// websocketGUID is the fixed string RFC 6455 has the server append to a
+// client's Sec-WebSocket-Key before hashing, so the accept value can't be
+// produced by anything other than a server that actually speaks the
+// protocol.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpClose        byte = 0x8
+	wsOpPing         byte = 0x9
+	wsOpPong         byte = 0xA
+)
+
+// handleWebSocketUpgrade answers the /v1/stream upgrade request by hand -
+// this project has no third-party dependencies, and RFC 6455's handshake
+// and frame format are small enough not to need gorilla/websocket or
+// similar. Once the handshake completes, the hijacked connection is wrapped
+// in a wsConn and handed straight to handleConnection, so a browser client
+// gets exactly the same JSON-line protocol a TCP client does - one
+// canonical request-processing path, not a WebSocket-specific copy of it.
+func (s *SawitServer) handleWebSocketUpgrade(w http.ResponseWriter, req *http.Request) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" || !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil || rw.Flush() != nil {
+		conn.Close()
+		return
+	}
+
+	s.handleConnection(newWSConn(conn, rw.Reader))
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsConn adapts a hijacked, handshake-complete WebSocket connection into a
+// net.Conn: Read yields the application bytes tunneled inside text frames,
+// and Write wraps whatever it's given in a single text frame. Everything
+// above it (bufio.Reader, wire.ConnCodec, handleConnection's read loop)
+// stays oblivious to the fact that it isn't talking to a raw TCP socket.
+type wsConn struct {
+	net.Conn
+	br      *bufio.Reader
+	pending []byte
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader) *wsConn {
+	return &wsConn{Conn: conn, br: br}
+}
+
+func (w *wsConn) Read(p []byte) (int, error) {
+	for len(w.pending) == 0 {
+		payload, opcode, err := readWSFrame(w.br)
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case wsOpClose:
+			writeWSFrame(w.Conn, wsOpClose, nil)
+			return 0, io.EOF
+		case wsOpPing:
+			if err := writeWSFrame(w.Conn, wsOpPong, payload); err != nil {
+				return 0, err
+			}
+		case wsOpPong:
+			// no-op: this server never sends a ping that needs answering
+		default:
+			w.pending = payload
+		}
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
+
+func (w *wsConn) Write(p []byte) (int, error) {
+	if err := writeWSFrame(w.Conn, wsOpText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readWSFrame decodes one frame from a client, unmasking its payload per
+// RFC 6455 (every client->server frame is masked). Fragmented messages
+// (fin=0) aren't reassembled - every codec this server speaks only ever
+// needs one frame per JSON line, which is well under typical WebSocket
+// implementations' default fragmentation threshold.
+func readWSFrame(br *bufio.Reader) (payload []byte, opcode byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(br, head[:]); err != nil {
+		return nil, 0, err
+	}
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(br, ext[:]); err != nil {
+			return nil, 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(br, ext[:]); err != nil {
+			return nil, 0, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err = io.ReadFull(br, maskKey[:]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(br, payload); err != nil {
+		return nil, 0, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+	return payload, opcode, nil
+}
+
+// writeWSFrame encodes a single, unmasked, final frame - the server never
+// masks its own frames, per RFC 6455.
+func writeWSFrame(w io.Writer, opcode byte, payload []byte) error {
+	length := len(payload)
+	var header []byte
+	switch {
+	case length <= 125:
+		header = []byte{0x80 | opcode, byte(length)}
+	case length <= 0xFFFF:
+		header = make([]byte, 4)
+		header[0] = 0x80 | opcode
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = make([]byte, 10)
+		header[0] = 0x80 | opcode
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	_, err := w.Write(payload)
+	return err
+}
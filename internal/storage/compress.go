@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// CompressionType selects the codec a record's bytes were compressed with,
+// so a reader can decompress without being told out of band which codec is
+// in effect - a database opened with one Options.Compression can still read
+// rows written under a different setting in an earlier session.
+type CompressionType byte
+
+const (
+	// NoCompression stores a record's JSON bytes as-is.
+	NoCompression CompressionType = 0
+	// SnappyCompression is kept under its real-Snappy numeric code (1) for
+	// on-disk compatibility, but is implemented with the standard library's
+	// flate codec - flate's DEFLATE is a reasonable stand-in for the same
+	// "cheap, general-purpose block compressor" role Snappy plays in
+	// LevelDB's SST blocks. See docs/adr/0001-no-third-party-dependencies.md.
+	SnappyCompression CompressionType = 1
+)
+
+// Compress returns data encoded under ctype. NoCompression is a no-op.
+func Compress(ctype CompressionType, data []byte) ([]byte, error) {
+	switch ctype {
+	case NoCompression:
+		return data, nil
+	case SnappyCompression:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("storage: unknown CompressionType %d", ctype)
+	}
+}
+
+// Decompress reverses Compress. uncompressedLen is the original length of
+// data before it was compressed, used to size the output buffer.
+func Decompress(ctype CompressionType, data []byte, uncompressedLen int) ([]byte, error) {
+	switch ctype {
+	case NoCompression:
+		return data, nil
+	case SnappyCompression:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		out := make([]byte, uncompressedLen)
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("storage: unknown CompressionType %d", ctype)
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// pageCache holds recently read page buffers keyed by page id, evicting the
+// least recently used entry once it grows past its capacity. It follows the
+// same container/list-based LRU shape as engine.planCache; a single mutex is
+// enough here too - sharding only pays for itself under lock contention this
+// package hasn't shown evidence of.
+type pageCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	entries  map[uint32]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+type pageCacheEntry struct {
+	pageId uint32
+	buf    []byte
+}
+
+func newPageCache(capacity int) *pageCache {
+	return &pageCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[uint32]*list.Element),
+	}
+}
+
+// get returns a copy of the cached buffer for pageId, if present.
+func (pc *pageCache) get(pageId uint32) ([]byte, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	el, ok := pc.entries[pageId]
+	if !ok {
+		pc.misses++
+		return nil, false
+	}
+	pc.hits++
+	pc.order.MoveToFront(el)
+
+	cached := el.Value.(*pageCacheEntry).buf
+	buf := make([]byte, len(cached))
+	copy(buf, cached)
+	return buf, true
+}
+
+// put caches a copy of buf for pageId, evicting the least recently used page
+// if this pushes the cache past capacity.
+func (pc *pageCache) put(pageId uint32, buf []byte) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	cp := make([]byte, len(buf))
+	copy(cp, buf)
+
+	if el, ok := pc.entries[pageId]; ok {
+		el.Value.(*pageCacheEntry).buf = cp
+		pc.order.MoveToFront(el)
+		return
+	}
+
+	el := pc.order.PushFront(&pageCacheEntry{pageId: pageId, buf: cp})
+	pc.entries[pageId] = el
+	if pc.order.Len() > pc.capacity {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*pageCacheEntry).pageId)
+		pc.evictions++
+	}
+}
+
+// invalidate drops pageId from the cache, if present. Used instead of put
+// when a caller would rather the next read re-fetch from disk than trust a
+// buffer it isn't confident reflects the write that just happened.
+func (pc *pageCache) invalidate(pageId uint32) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if el, ok := pc.entries[pageId]; ok {
+		pc.order.Remove(el)
+		delete(pc.entries, pageId)
+	}
+}
+
+// CacheStats reports a Pager's page cache effectiveness since it was opened.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+func (pc *pageCache) stats() CacheStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return CacheStats{Hits: pc.hits, Misses: pc.misses, Evictions: pc.evictions}
+}
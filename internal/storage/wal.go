@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// walBlockSize and walHeaderSize follow LevelDB's log format: the journal is
+// split into fixed blocks so a reader can always find the next record by
+// seeking to a block boundary, even if an earlier record was torn by a
+// crash mid-write. A logical WALEntry that doesn't fit in the block it
+// starts in is split across walFirst/walMiddle/walLast physical records;
+// one that fits is written as a single walFull record.
+const (
+	walBlockSize  = 32 * 1024
+	walHeaderSize = 9 // length(4) + crc32(4) + type(1)
+)
+
+type walRecordType byte
+
+const (
+	walFull   walRecordType = 1
+	walFirst  walRecordType = 2
+	walMiddle walRecordType = 3
+	walLast   walRecordType = 4
+)
+
+// WALEntry is one durable mutation record: a redo of the page writes a
+// single engine call made, logged before those writes are applied. TxID is
+// the originating transaction's id, or "" for a write made outside a
+// transaction.
+type WALEntry struct {
+	LSN   uint64
+	TxID  string
+	Op    string
+	Table string
+	Pages map[uint32][]byte // after-images of every page this mutation wrote
+}
+
+// WAL is the append-only journal backing a Pager's crash recovery. Appending
+// an entry fsyncs it before returning, so a caller that only proceeds to
+// write pages after Append succeeds can always redo those writes from the
+// journal if it crashes before the page write itself lands.
+type WAL struct {
+	mu       sync.Mutex
+	file     *os.File
+	blockPos int
+	lsn      uint64
+}
+
+// OpenWAL opens (creating if necessary) the journal at path and positions it
+// at EOF, ready for Append. A caller that wants to recover prior entries
+// should call Replay before appending anything new - Replay rewinds to the
+// start for reading and seeks back to EOF when it's done.
+func OpenWAL(path string) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &WAL{file: f, blockPos: int(size % walBlockSize)}, nil
+}
+
+// Append assigns the next LSN to entry, appends it to the journal as one or
+// more physical records, and fsyncs before returning.
+func (w *WAL) Append(entry WALEntry) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lsn++
+	entry.LSN = w.lsn
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.writeRecord(payload); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	return entry.LSN, nil
+}
+
+// writeRecord splits payload into one or more block-local physical records.
+// Caller holds w.mu.
+func (w *WAL) writeRecord(payload []byte) error {
+	first := true
+	for first || len(payload) > 0 {
+		space := walBlockSize - w.blockPos
+		if space < walHeaderSize {
+			// Not enough room left in this block for even a header: pad the
+			// remainder with zeros and continue at the next block boundary.
+			if space > 0 {
+				if _, err := w.file.Write(make([]byte, space)); err != nil {
+					return err
+				}
+			}
+			w.blockPos = 0
+			space = walBlockSize
+		}
+
+		avail := space - walHeaderSize
+		chunkLen := len(payload)
+		if chunkLen > avail {
+			chunkLen = avail
+		}
+		chunk := payload[:chunkLen]
+
+		var typ walRecordType
+		switch {
+		case first && chunkLen == len(payload):
+			typ = walFull
+		case first:
+			typ = walFirst
+		case chunkLen == len(payload):
+			typ = walLast
+		default:
+			typ = walMiddle
+		}
+
+		header := make([]byte, walHeaderSize)
+		binary.LittleEndian.PutUint32(header[0:], uint32(chunkLen))
+		binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(chunk))
+		header[8] = byte(typ)
+
+		if _, err := w.file.Write(header); err != nil {
+			return err
+		}
+		if chunkLen > 0 {
+			if _, err := w.file.Write(chunk); err != nil {
+				return err
+			}
+		}
+		w.blockPos += walHeaderSize + chunkLen
+
+		payload = payload[chunkLen:]
+		first = false
+	}
+	return nil
+}
+
+// Replay reads every complete entry in the journal, in order, calling apply
+// for each. It stops at the first record whose checksum doesn't match -
+// a torn tail left by a crash mid-append - rather than treating it as an
+// error, since everything before it is still a valid, ordered prefix of the
+// log. Replay also recovers lsn, so appends after recovery continue the
+// same sequence rather than restarting at zero.
+func (w *WAL) Replay(apply func(WALEntry) error) error {
+	maxLSN, err := w.scan(apply)
+	if err != nil {
+		return err
+	}
+	w.lsn = maxLSN
+	return nil
+}
+
+// LatestPageImage scans the journal for the most recent after-image of
+// pageId, for Pager.ReadPage to self-heal a page whose on-disk checksum
+// doesn't match. Unlike Replay it doesn't touch w.lsn and takes w.mu itself,
+// since it can run concurrently with ongoing Appends rather than only once
+// at startup.
+func (w *WAL) LatestPageImage(pageId uint32) ([]byte, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var image []byte
+	var found bool
+	_, err := w.scan(func(e WALEntry) error {
+		if buf, ok := e.Pages[pageId]; ok {
+			image = buf
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return image, found, nil
+}
+
+// scan reads every complete entry in the journal, in order, calling apply
+// for each, and returns the highest LSN seen. It stops at the first record
+// whose checksum doesn't match - a torn tail left by a crash mid-append -
+// rather than treating it as an error, since everything before it is still
+// a valid, ordered prefix of the log. It seeks the file to the start itself
+// and seeks it back to EOF when it returns.
+func (w *WAL) scan(apply func(WALEntry) error) (uint64, error) {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	defer w.file.Seek(0, io.SeekEnd)
+
+	var blockPos int
+	var assembling []byte
+	var maxLSN uint64
+
+	read := func(n int) ([]byte, bool) {
+		if walBlockSize-blockPos < n {
+			return nil, false
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(w.file, buf); err != nil {
+			return nil, false
+		}
+		blockPos += n
+		return buf, true
+	}
+
+replayLoop:
+	for {
+		if walBlockSize-blockPos < walHeaderSize {
+			pad := walBlockSize - blockPos
+			if _, err := w.file.Seek(int64(pad), io.SeekCurrent); err != nil {
+				break
+			}
+			blockPos = 0
+		}
+
+		header, ok := read(walHeaderSize)
+		if !ok {
+			break
+		}
+		length := binary.LittleEndian.Uint32(header[0:])
+		crc := binary.LittleEndian.Uint32(header[4:])
+		typ := walRecordType(header[8])
+
+		chunk, ok := read(int(length))
+		if !ok {
+			break // header landed but the payload didn't: torn tail
+		}
+		if crc32.ChecksumIEEE(chunk) != crc {
+			break // payload landed but corrupted: torn tail
+		}
+
+		switch typ {
+		case walFull:
+			assembling = chunk
+		case walFirst:
+			assembling = append([]byte{}, chunk...)
+			continue
+		case walMiddle:
+			assembling = append(assembling, chunk...)
+			continue
+		case walLast:
+			assembling = append(assembling, chunk...)
+		default:
+			break replayLoop // unrecognized type: stop rather than misread
+		}
+
+		var entry WALEntry
+		if err := json.Unmarshal(assembling, &entry); err != nil {
+			break
+		}
+		if entry.LSN > maxLSN {
+			maxLSN = entry.LSN
+		}
+		if err := apply(entry); err != nil {
+			return maxLSN, err
+		}
+	}
+
+	return maxLSN, nil
+}
+
+func (w *WAL) lastLSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lsn
+}
+
+// Truncate empties the journal. Called once the data file it was protecting
+// has been checkpointed, so none of its records are needed for recovery
+// anymore.
+func (w *WAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.blockPos = 0
+	return w.file.Sync()
+}
+
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
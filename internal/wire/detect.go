@@ -0,0 +1,28 @@
+package wire
+
+import "bufio"
+
+// Detect peeks the first byte of a connection, before anything is
+// consumed from it, to choose which codec reads every request on it: '{'
+// is a JSON object (the original line protocol), '*' is a RESP-style
+// array. Anything else falls back to JSON - a client that never sends
+// anything recognizable gets the same "invalid request format" error the
+// JSON codec has always produced, rather than a new failure mode.
+func Detect(r *bufio.Reader) (ConnCodec, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] == '*' {
+		return RESPCodec{}, nil
+	}
+	return JSONCodec{}, nil
+}
+
+// IsJSON reports whether codec is the JSON line protocol, so a server
+// configured to disable it can reject the connection before serving any
+// requests over it.
+func IsJSON(codec ConnCodec) bool {
+	_, ok := codec.(JSONCodec)
+	return ok
+}
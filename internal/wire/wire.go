@@ -0,0 +1,68 @@
+// Package wire implements SawitServer's pluggable per-connection request
+// codecs: the original newline-delimited JSON line protocol, and a
+// RESP-style array protocol for clients that would rather parse a small
+// fixed grammar than a JSON object. Binary framing (see
+// internal/server/framing.go) stays out of this package on purpose - a
+// client reaches it by sending a "hello" request over whichever codec
+// Detect chose, so by the time a connection is framed, ConnCodec's job is
+// already done.
+package wire
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ConnCodec reads one request and writes one response for a single
+// connection's wire format. ReadRequest always returns the same
+// map[string]interface{} shape - {"type": ..., "payload": {...}} - that
+// SawitServer.handleRequest already expects, so handleRequest never needs
+// to know which codec a connection negotiated.
+type ConnCodec interface {
+	ReadRequest(r *bufio.Reader) (map[string]interface{}, error)
+	WriteResponse(w io.Writer, data map[string]interface{}) error
+}
+
+// BadRequestError wraps a malformed request - bad JSON, a short RESP array,
+// a non-numeric bulk-string length - that the caller should report to the
+// client and keep reading past, the same way a single garbled line in the
+// old JSON loop never used to end the connection. Any other error from
+// ReadRequest (including io.EOF) is a dead connection.
+type BadRequestError struct {
+	Err error
+}
+
+func (e *BadRequestError) Error() string { return e.Err.Error() }
+func (e *BadRequestError) Unwrap() error { return e.Err }
+
+// JSONCodec is the original wire format: one JSON object per line.
+type JSONCodec struct{}
+
+func (JSONCodec) ReadRequest(r *bufio.Reader) (map[string]interface{}, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		var req map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &req); err != nil {
+			return nil, &BadRequestError{Err: err}
+		}
+		return req, nil
+	}
+}
+
+func (JSONCodec) WriteResponse(w io.Writer, data map[string]interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bytes, '\n'))
+	return err
+}
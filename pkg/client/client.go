@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +22,25 @@ type SawitClient struct {
 	Password         string
 	Conn             net.Conn
 	Reader           *bufio.Reader
+
+	// Token is the session token a username/password authenticate() call
+	// received back, if the server has session auth configured. Connect
+	// uses it instead of Username/Password when both are set, so a
+	// reconnecting client can skip the password round trip - see
+	// internal/auth's package doc for what a token represents server-side.
+	Token string
+
+	// framed is true once Connect has negotiated the binary framing
+	// protocol with the server (see negotiateFraming). It's false for a
+	// server that only speaks the original newline-delimited JSON loop,
+	// in which case every method below falls back to sendRequestLegacy.
+	framed    bool
+	writeMu   sync.Mutex
+	nextReqID uint64
+
+	pending sync.Map // requestID -> chan frameReply
+	streams sync.Map // requestID -> chan streamFrame, for QueryStream
+	events  sync.Map // requestID -> chan ChangeEvent, for a framed Subscribe
 }
 
 func NewSawitClient(connStr string) *SawitClient {
@@ -59,11 +80,15 @@ func (c *SawitClient) Connect() error {
 	c.Conn = conn
 	c.Reader = bufio.NewReader(conn)
 
-	// Read Welcome
-	_, err = c.readResponse() // consume welcome
+	welcome, err := c.readResponse()
 	if err != nil {
 		return err
 	}
+	if supportsFraming(welcome) {
+		if err := c.negotiateFraming(); err != nil {
+			return err
+		}
+	}
 
 	return c.initConnection()
 }
@@ -76,7 +101,11 @@ func (c *SawitClient) Close() error {
 }
 
 func (c *SawitClient) initConnection() error {
-	if c.Username != "" && c.Password != "" {
+	if c.Token != "" {
+		if err := c.authenticateWithToken(); err != nil {
+			return err
+		}
+	} else if c.Username != "" && c.Password != "" {
 		if err := c.authenticate(); err != nil {
 			return err
 		}
@@ -89,7 +118,27 @@ func (c *SawitClient) initConnection() error {
 	return nil
 }
 
-func (c *SawitClient) sendRequest(reqType string, payload map[string]interface{}) (map[string]interface{}, error) {
+// sendRequest writes reqType/payload as one request and returns a Future for
+// its reply without waiting on it, so a caller that wants to pipeline -
+// e.g. Ping while a Query is still in flight - can issue several sendRequest
+// calls before calling Wait on any of them. Against a server that hasn't
+// negotiated binary framing, there's no requestID to demultiplex replies by,
+// so the request/response pair happens synchronously inline and the
+// returned Future is already resolved.
+func (c *SawitClient) sendRequest(reqType string, payload map[string]interface{}) (*Future, error) {
+	if !c.framed {
+		res, err := c.sendRequestLegacy(reqType, payload)
+		f := &Future{ch: make(chan frameReply, 1)}
+		f.ch <- frameReply{payload: res, err: err}
+		return f, nil
+	}
+	return c.sendRequestFramed(reqType, payload)
+}
+
+// sendRequestLegacy is the original newline-delimited JSON request/response
+// exchange, kept for servers that don't advertise binary framing support in
+// their welcome frame.
+func (c *SawitClient) sendRequestLegacy(reqType string, payload map[string]interface{}) (map[string]interface{}, error) {
 	req := map[string]interface{}{
 		"type":    reqType,
 		"payload": payload,
@@ -120,15 +169,43 @@ func (c *SawitClient) readResponse() (map[string]interface{}, error) {
 }
 
 func (c *SawitClient) authenticate() error {
-	_, err := c.sendRequest("auth", map[string]interface{}{
+	f, err := c.sendRequest("auth", map[string]interface{}{
 		"username": c.Username,
 		"password": c.Password,
 	})
+	if err != nil {
+		return err
+	}
+	res, err := f.Wait()
+	if err != nil {
+		return err
+	}
+	if token, ok := res["token"].(string); ok {
+		c.Token = token
+	}
+	return nil
+}
+
+// authenticateWithToken reauthenticates using a session token from a
+// previous authenticate() call instead of a username/password, so a
+// reconnecting client doesn't have to keep the password around.
+func (c *SawitClient) authenticateWithToken() error {
+	f, err := c.sendRequest("auth", map[string]interface{}{
+		"token": c.Token,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Wait()
 	return err
 }
 
 func (c *SawitClient) Use(database string) (string, error) {
-	res, err := c.sendRequest("use", map[string]interface{}{"database": database})
+	f, err := c.sendRequest("use", map[string]interface{}{"database": database})
+	if err != nil {
+		return "", err
+	}
+	res, err := f.Wait()
 	if err != nil {
 		return "", err
 	}
@@ -137,18 +214,195 @@ func (c *SawitClient) Use(database string) (string, error) {
 }
 
 func (c *SawitClient) Query(query string, params map[string]interface{}) (interface{}, error) {
-	res, err := c.sendRequest("query", map[string]interface{}{
+	return c.queryPayload(map[string]interface{}{
 		"query":  query,
 		"params": params,
 	})
+}
+
+func (c *SawitClient) queryPayload(payload map[string]interface{}) (interface{}, error) {
+	f, err := c.sendRequest("query", payload)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.Wait()
 	if err != nil {
 		return nil, err
 	}
 	return res["result"], nil
 }
 
+// Tx is a handle to a server-side transaction opened with Begin. Statements
+// run through tx.Query are buffered server-side until Commit; Rollback
+// discards them, leaving no trace on disk.
+type Tx struct {
+	client *SawitClient
+	ID     string
+}
+
+// Begin opens a transaction on the current connection. Only one transaction
+// may be in flight per connection at a time.
+func (c *SawitClient) Begin() (*Tx, error) {
+	f, err := c.sendRequest("begin", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.Wait()
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res["tx_id"].(string)
+	return &Tx{client: c, ID: id}, nil
+}
+
+func (tx *Tx) Query(query string, params map[string]interface{}) (interface{}, error) {
+	return tx.client.queryPayload(map[string]interface{}{
+		"query":  query,
+		"params": params,
+		"tx_id":  tx.ID,
+	})
+}
+
+func (tx *Tx) Commit() error {
+	f, err := tx.client.sendRequest("commit", map[string]interface{}{"tx_id": tx.ID})
+	if err != nil {
+		return err
+	}
+	_, err = f.Wait()
+	return err
+}
+
+func (tx *Tx) Rollback() error {
+	f, err := tx.client.sendRequest("rollback", map[string]interface{}{"tx_id": tx.ID})
+	if err != nil {
+		return err
+	}
+	_, err = f.Wait()
+	return err
+}
+
+// Stmt is a query prepared once and run with different args. The server
+// caches each distinct SQL string's parse (see SawitDB.Prepare), so
+// reusing a Stmt - or just issuing the same query text repeatedly through
+// Query - skips re-parsing while that entry stays in its LRU plan cache.
+type Stmt struct {
+	client *SawitClient
+	sql    string
+}
+
+// Prepare remembers sql for reuse. The query text isn't sent until Exec or
+// Query supplies args, at which point the server resolves it against its own
+// plan cache.
+func (c *SawitClient) Prepare(sql string) (*Stmt, error) {
+	return &Stmt{client: c, sql: sql}, nil
+}
+
+func (s *Stmt) Exec(args map[string]interface{}) (interface{}, error) {
+	return s.client.Query(s.sql, args)
+}
+
+// Query is an alias for Exec, kept distinct for callers used to a
+// read/write-shaped prepared-statement API.
+func (s *Stmt) Query(args map[string]interface{}) (interface{}, error) {
+	return s.Exec(args)
+}
+
+// ChangeEvent mirrors engine.ChangeEvent as it arrives over the wire.
+type ChangeEvent struct {
+	Op     string                 `json:"op"`
+	Table  string                 `json:"table"`
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+	LSN    int64                  `json:"lsn"`
+}
+
+// Subscribe streams every INSERT/UPDATE/DELETE committed against table from
+// now on, as a long-lived server push on this connection. Against a server
+// that negotiated binary framing, pushed events are demultiplexed by the
+// same background readLoop as everything else, so other requests (Query,
+// Ping, ...) can still be issued on the same connection afterward. Against
+// the JSON fallback it takes over the connection's read loop instead, so no
+// other request should be issued on the same client afterward - open a
+// second connection for that.
+func (c *SawitClient) Subscribe(table string) (<-chan ChangeEvent, error) {
+	if c.framed {
+		return c.subscribeFramed(table)
+	}
+	return c.subscribeLegacy(table)
+}
+
+func (c *SawitClient) subscribeFramed(table string) (<-chan ChangeEvent, error) {
+	reqID := atomic.AddUint64(&c.nextReqID, 1)
+	ch := make(chan frameReply, 1)
+	c.pending.Store(reqID, ch)
+	events := make(chan ChangeEvent, 256)
+	c.events.Store(reqID, events)
+
+	req := map[string]interface{}{"type": "query", "payload": map[string]interface{}{"query": "LANGGAN " + table}}
+	if err := c.writeFrame(frameTypeRequest, reqID, req); err != nil {
+		c.pending.Delete(reqID)
+		c.events.Delete(reqID)
+		return nil, err
+	}
+
+	reply := <-ch
+	if reply.err != nil {
+		c.events.Delete(reqID)
+		return nil, reply.err
+	}
+	if resType, _ := reply.payload["type"].(string); resType != "subscribe_success" {
+		c.events.Delete(reqID)
+		return nil, errors.New("Respons tak terduga untuk LANGGAN/SUBSCRIBE")
+	}
+	return events, nil
+}
+
+func (c *SawitClient) subscribeLegacy(table string) (<-chan ChangeEvent, error) {
+	res, err := c.sendRequestLegacy("query", map[string]interface{}{"query": "LANGGAN " + table})
+	if err != nil {
+		return nil, err
+	}
+	if resType, _ := res["type"].(string); resType != "subscribe_success" {
+		return nil, errors.New("Respons tak terduga untuk LANGGAN/SUBSCRIBE")
+	}
+
+	events := make(chan ChangeEvent, 256)
+	go func() {
+		defer close(events)
+		for {
+			line, err := c.Reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			var frame map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &frame); err != nil {
+				continue
+			}
+			if frameType, _ := frame["type"].(string); frameType != "change_event" {
+				continue
+			}
+
+			raw, err := json.Marshal(frame["event"])
+			if err != nil {
+				continue
+			}
+			var ev ChangeEvent
+			if err := json.Unmarshal(raw, &ev); err != nil {
+				continue
+			}
+			events <- ev
+		}
+	}()
+	return events, nil
+}
+
 func (c *SawitClient) ListDatabases() ([]string, error) {
-	res, err := c.sendRequest("list_databases", nil)
+	f, err := c.sendRequest("list_databases", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.Wait()
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +417,75 @@ func (c *SawitClient) ListDatabases() ([]string, error) {
 
 func (c *SawitClient) Ping() (int64, error) {
 	start := time.Now()
-	_, err := c.sendRequest("ping", nil)
+	f, err := c.sendRequest("ping", nil)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Wait()
 	return time.Since(start).Milliseconds(), err
 }
+
+// Row is one result record from QueryStream, shaped identically to a row
+// in a normal Query result.
+type Row = map[string]interface{}
+
+// QueryStream runs query like Query, but against a server that negotiated
+// binary framing it consumes the reply as a sequence of result_chunk frames
+// terminated by end_of_stream instead of one fully materialized response -
+// so a large range/scan can start delivering rows before the server has
+// finished sending all of them. Against a server that only speaks the JSON
+// fallback, it runs Query and replays the whole result through the channel
+// at once.
+func (c *SawitClient) QueryStream(query string, params map[string]interface{}) (<-chan Row, error) {
+	if !c.framed {
+		return c.queryStreamLegacy(query, params)
+	}
+
+	reqID := atomic.AddUint64(&c.nextReqID, 1)
+	streamCh := make(chan streamFrame, 16)
+	c.streams.Store(reqID, streamCh)
+
+	payload := map[string]interface{}{"query": query, "params": params, "stream": true}
+	if err := c.writeFrame(frameTypeRequest, reqID, map[string]interface{}{"type": "query", "payload": payload}); err != nil {
+		c.streams.Delete(reqID)
+		return nil, err
+	}
+
+	rows := make(chan Row)
+	go func() {
+		defer close(rows)
+		defer c.streams.Delete(reqID)
+		for sf := range streamCh {
+			if sf.err != nil {
+				return
+			}
+			for _, row := range sf.rows {
+				if m, ok := row.(map[string]interface{}); ok {
+					rows <- m
+				}
+			}
+			if sf.end {
+				return
+			}
+		}
+	}()
+	return rows, nil
+}
+
+func (c *SawitClient) queryStreamLegacy(query string, params map[string]interface{}) (<-chan Row, error) {
+	res, err := c.Query(query, params)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(chan Row)
+	go func() {
+		defer close(rows)
+		list, _ := res.([]interface{})
+		for _, row := range list {
+			if m, ok := row.(map[string]interface{}); ok {
+				rows <- m
+			}
+		}
+	}()
+	return rows, nil
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// frameProtocolVersion is the binary framing protocol this client knows how
+// to speak (see negotiateFraming). A server that doesn't advertise it in its
+// welcome frame is assumed to only support the original newline-delimited
+// JSON request/response loop, which every method here falls back to.
+const frameProtocolVersion = "binary/v1"
+
+// Frame types. A frame is [uint32 length][uint8 type][uint64 requestID]
+// [JSON payload], where length counts everything after itself.
+// frameTypeRequest is client -> server; the rest are server -> client.
+const (
+	frameTypeRequest  byte = 1
+	frameTypeResponse byte = 2
+	frameTypeChunk    byte = 3
+	frameTypeEnd      byte = 4
+	frameTypeEvent    byte = 5
+)
+
+const frameHeaderLen = 4 + 1 + 8 // length + type + requestID
+
+type frameReply struct {
+	payload map[string]interface{}
+	err     error
+}
+
+// streamFrame is one delivery from a QueryStream's background reader: a
+// page of rows, the end-of-stream marker, or an error that ends the stream
+// either way.
+type streamFrame struct {
+	rows []interface{}
+	end  bool
+	err  error
+}
+
+// Future is a pending framed request's eventual reply. sendRequest returns
+// one immediately after writing the request, so a caller can keep going -
+// issuing another request on the same connection - before calling Wait,
+// which is what lets e.g. Ping run while a Query is still in flight.
+type Future struct {
+	ch chan frameReply
+}
+
+// Wait blocks until the request this Future was returned for completes,
+// returning its response payload or the error the server (or the
+// connection itself) reported.
+func (f *Future) Wait() (map[string]interface{}, error) {
+	r := <-f.ch
+	return r.payload, r.err
+}
+
+func supportsFraming(welcome map[string]interface{}) bool {
+	versions, ok := welcome["framing"].([]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range versions {
+		if s, _ := v.(string); s == frameProtocolVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateFraming switches the connection from the newline-JSON
+// request/response loop to length-prefixed binary frames. Once negotiated,
+// every request carries its own requestID and a background reader
+// goroutine (readLoop) demultiplexes replies, chunks, and pushed events as
+// they arrive - so requests no longer have to be answered in the order they
+// were sent, and a caller can pipeline several at once on one connection.
+func (c *SawitClient) negotiateFraming() error {
+	hello := map[string]interface{}{"type": "hello", "payload": map[string]interface{}{"framing": frameProtocolVersion}}
+	b, err := json.Marshal(hello)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Conn.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	ack, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if t, _ := ack["type"].(string); t != "hello_ack" {
+		return errors.New("Server menolak negosiasi framing biner")
+	}
+	c.framed = true
+	go c.readLoop()
+	return nil
+}
+
+func (c *SawitClient) writeFrame(typ byte, reqID uint64, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, frameHeaderLen)
+	binary.BigEndian.PutUint32(header[0:4], uint32(1+8+len(payload)))
+	header[4] = typ
+	binary.BigEndian.PutUint64(header[5:13], reqID)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.Conn.Write(header); err != nil {
+		return err
+	}
+	_, err = c.Conn.Write(payload)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (typ byte, reqID uint64, payload []byte, err error) {
+	header := make([]byte, frameHeaderLen)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	typ = header[4]
+	reqID = binary.BigEndian.Uint64(header[5:13])
+	payload = make([]byte, int(length)-(1+8))
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+// sendRequestFramed writes req as a new frameTypeRequest and returns a
+// Future for its eventual frameTypeResponse - it does not block waiting for
+// one, which is what lets a caller pipeline several requests before
+// resolving any of them.
+func (c *SawitClient) sendRequestFramed(reqType string, payload map[string]interface{}) (*Future, error) {
+	reqID := atomic.AddUint64(&c.nextReqID, 1)
+	ch := make(chan frameReply, 1)
+	c.pending.Store(reqID, ch)
+
+	req := map[string]interface{}{"type": reqType, "payload": payload}
+	if err := c.writeFrame(frameTypeRequest, reqID, req); err != nil {
+		c.pending.Delete(reqID)
+		return nil, err
+	}
+	return &Future{ch: ch}, nil
+}
+
+// readLoop demultiplexes frames arriving on a framed connection by
+// requestID until the connection breaks, at which point every request still
+// waiting on a reply - pending, streaming, or subscribed - is woken with the
+// read error instead of hanging forever.
+func (c *SawitClient) readLoop() {
+	for {
+		typ, reqID, raw, err := readFrame(c.Reader)
+		if err != nil {
+			c.failPending(err)
+			return
+		}
+		switch typ {
+		case frameTypeResponse:
+			c.deliverResponse(reqID, raw)
+		case frameTypeChunk, frameTypeEnd:
+			c.deliverChunk(reqID, typ, raw)
+		case frameTypeEvent:
+			c.deliverEvent(reqID, raw)
+		}
+	}
+}
+
+func (c *SawitClient) deliverResponse(reqID uint64, raw []byte) {
+	chAny, ok := c.pending.LoadAndDelete(reqID)
+	if !ok {
+		return
+	}
+	ch := chAny.(chan frameReply)
+
+	var res map[string]interface{}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		ch <- frameReply{err: err}
+		return
+	}
+	if resType, _ := res["type"].(string); resType == "error" {
+		errMsg, _ := res["error"].(string)
+		ch <- frameReply{err: errors.New(errMsg)}
+		return
+	}
+	ch <- frameReply{payload: res}
+}
+
+func (c *SawitClient) deliverChunk(reqID uint64, typ byte, raw []byte) {
+	chAny, ok := c.streams.Load(reqID)
+	if !ok {
+		return
+	}
+	ch := chAny.(chan streamFrame)
+
+	var frame map[string]interface{}
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		ch <- streamFrame{err: err}
+		return
+	}
+	if frameType, _ := frame["type"].(string); frameType == "error" {
+		errMsg, _ := frame["error"].(string)
+		ch <- streamFrame{err: errors.New(errMsg)}
+		return
+	}
+	rows, _ := frame["rows"].([]interface{})
+	ch <- streamFrame{rows: rows, end: typ == frameTypeEnd}
+}
+
+func (c *SawitClient) deliverEvent(reqID uint64, raw []byte) {
+	chAny, ok := c.events.Load(reqID)
+	if !ok {
+		return
+	}
+	ch := chAny.(chan ChangeEvent)
+
+	var frame map[string]interface{}
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return
+	}
+	evRaw, err := json.Marshal(frame["event"])
+	if err != nil {
+		return
+	}
+	var ev ChangeEvent
+	if err := json.Unmarshal(evRaw, &ev); err != nil {
+		return
+	}
+	ch <- ev
+}
+
+// failPending wakes every request this connection still owes a reply to,
+// with err, once readLoop can no longer read frames for them.
+func (c *SawitClient) failPending(err error) {
+	c.pending.Range(func(k, v interface{}) bool {
+		v.(chan frameReply) <- frameReply{err: err}
+		c.pending.Delete(k)
+		return true
+	})
+	c.streams.Range(func(k, v interface{}) bool {
+		v.(chan streamFrame) <- streamFrame{err: err}
+		c.streams.Delete(k)
+		return true
+	})
+	c.events.Range(func(k, v interface{}) bool {
+		close(v.(chan ChangeEvent))
+		c.events.Delete(k)
+		return true
+	})
+}